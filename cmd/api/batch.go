@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/thomascastle/tarsk/internal/data"
+	"github.com/thomascastle/tarsk/internal/validator"
+)
+
+var (
+	errorBatchFailed    = errors.New("batch failed")
+	errorTooManyMatches = errors.New("too many matching tasks")
+)
+
+// maxBatchOperations caps the operations of a batch as well as the tasks a
+// filter may match, since they are all locked until the batch is committed.
+const maxBatchOperations = 100
+
+type taskPatch struct {
+	Description *string        `json:"description"`
+	Done        *bool          `json:"done"`
+	DueAt       *time.Time     `json:"due_at"`
+	Priority    *data.Priority `json:"priority"`
+	StartedAt   *time.Time     `json:"started_at"`
+}
+
+func (p taskPatch) apply(task *data.Task) {
+	if p.Description != nil {
+		task.Description = *p.Description
+	}
+	if p.Done != nil {
+		task.Done = *p.Done
+	}
+	if p.DueAt != nil {
+		task.DueAt = *p.DueAt
+	}
+	if p.Priority != nil {
+		task.Priority = *p.Priority
+	}
+	if p.StartedAt != nil {
+		task.StartedAt = *p.StartedAt
+	}
+}
+
+type batchOperation struct {
+	ID   string     `json:"id"`
+	Op   string     `json:"op"`
+	Task *taskPatch `json:"task"`
+}
+
+func (o batchOperation) validate(v *validator.Validator, key string) {
+	v.Check(validator.In(o.Op, "create", "update", "delete"), key, "op must be one of create, update or delete")
+	v.Check(o.Op == "create" || o.ID != "", key, "id is required for update and delete")
+	v.Check(o.Op == "delete" || o.Task != nil, key, "task is required for create and update")
+}
+
+type batchResult struct {
+	Error  interface{} `json:"error,omitempty"`
+	ID     string      `json:"id,omitempty"`
+	Index  int         `json:"index"`
+	Op     string      `json:"op"`
+	Status int         `json:"status"`
+	Task   *data.Task  `json:"task,omitempty"`
+}
+
+func (r batchResult) failed() bool {
+	return r.Status >= http.StatusBadRequest
+}
+
+// batchTasksHandler applies either a list of operations or a patch to every
+// task matching a filter. All changes are made in one transaction: if any item
+// fails, none is applied and the response tells which items failed.
+func (app *application) batchTasksHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Filter     map[string]string `json:"filter"`
+		Operations []batchOperation  `json:"operations"`
+		Patch      *taskPatch        `json:"patch"`
+	}
+
+	e := app.readJSON(w, r, &input)
+	if e != nil {
+		app.badRequestResponse(w, r, e)
+		return
+	}
+
+	v := validator.New()
+
+	var filters data.Filters
+	if input.Operations == nil {
+		v.Check(len(input.Filter) > 0, "filter", "must be provided when there are no operations")
+		v.Check(input.Patch != nil, "patch", "must be provided along with filter")
+
+		// An unknown or empty filter would be ignored, patching every task.
+		keys := make([]string, 0, len(input.Filter))
+		for key := range input.Filter {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		values := make(url.Values)
+		for _, key := range keys {
+			v.Check(validator.In(key, data.FilterNames...), "filter", fmt.Sprintf("unknown filter %q", key))
+			values.Set(key, input.Filter[key])
+		}
+		filters = data.ParseFilters(values)
+		v.Check(len(input.Filter) == 0 || len(filters) > 0, "filter", "must contain at least one non-empty filter")
+		filters.Validate(v)
+	} else {
+		v.Check(input.Filter == nil && input.Patch == nil, "operations", "must not be combined with filter and patch")
+		v.Check(len(input.Operations) > 0, "operations", "must contain at least one operation")
+		v.Check(len(input.Operations) <= maxBatchOperations, "operations", "must not contain more than 100 operations")
+
+		for _, operation := range input.Operations {
+			operation.validate(v, "operations")
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var results []batchResult
+
+	e = app.repositories.Tasks.WithContext(r.Context()).Transaction(func(tasks data.TaskRepository) error {
+		var e error
+
+		if input.Operations == nil {
+			results, e = patchTasks(tasks, &filters, *input.Patch)
+		} else {
+			results, e = applyOperations(tasks, input.Operations)
+		}
+		if e != nil {
+			return e
+		}
+
+		for _, result := range results {
+			if result.failed() {
+				return errorBatchFailed
+			}
+		}
+
+		return nil
+	})
+	if e != nil {
+		switch {
+		case errors.Is(e, errorTooManyMatches):
+			app.failedValidationResponse(w, r, map[string]string{"filter": fmt.Sprintf("must not match more than %d tasks", maxBatchOperations)})
+		case errors.Is(e, errorBatchFailed):
+			for i := range results {
+				if !results[i].failed() {
+					results[i].Status = http.StatusFailedDependency
+					results[i].Task = nil
+				}
+			}
+			e = app.writeJSON(w, http.StatusUnprocessableEntity, envelope{"results": results}, nil)
+			if e != nil {
+				app.serverErrorResponse(w, r, e)
+			}
+		default:
+			app.serverErrorResponse(w, r, e)
+		}
+		return
+	}
+
+	app.publishResults(eventContext(r), results)
+
+	e = app.writeJSON(w, http.StatusOK, envelope{"results": results}, nil)
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+	}
+}
+
+// publishResults publishes one event for each task affected by an applied
+// operation.
+func (app *application) publishResults(ctx context.Context, results []batchResult) {
+	for _, result := range results {
+		if result.failed() {
+			continue
+		}
+
+		var e error
+		switch result.Op {
+		case "create":
+			e = app.messageBrokerage.Created(ctx, result.Task)
+		case "update":
+			e = app.messageBrokerage.Updated(ctx, result.Task)
+		case "delete":
+			e = app.messageBrokerage.Deleted(ctx, result.ID)
+		}
+		if e != nil {
+			app.logger.Error(e, nil)
+		}
+	}
+}
+
+func applyOperations(tasks data.TaskRepository, operations []batchOperation) ([]batchResult, error) {
+	results := make([]batchResult, len(operations))
+
+	for i, operation := range operations {
+		result := batchResult{ID: operation.ID, Index: i, Op: operation.Op}
+
+		var e error
+		switch operation.Op {
+		case "create":
+			e = createTask(tasks, *operation.Task, &result)
+		case "update":
+			e = updateTask(tasks, operation.ID, *operation.Task, &result)
+		case "delete":
+			e = deleteTask(tasks, operation.ID, &result)
+		}
+		if e != nil {
+			return nil, e
+		}
+
+		results[i] = result
+	}
+
+	return results, nil
+}
+
+func patchTasks(tasks data.TaskRepository, filters *data.Filters, patch taskPatch) ([]batchResult, error) {
+	matches, e := tasks.SelectFiltered(filters, maxBatchOperations+1)
+	if e != nil {
+		return nil, e
+	}
+
+	if len(matches) > maxBatchOperations {
+		return nil, errorTooManyMatches
+	}
+
+	results := make([]batchResult, len(matches))
+
+	for i, task := range matches {
+		results[i] = batchResult{ID: task.ID, Index: i, Op: "update"}
+
+		e := saveTask(tasks, task, patch, &results[i])
+		if e != nil {
+			return nil, e
+		}
+	}
+
+	return results, nil
+}
+
+func createTask(tasks data.TaskRepository, patch taskPatch, result *batchResult) error {
+	task := &data.Task{}
+	patch.apply(task)
+	task.Priority = prioritize(task.Priority)
+
+	v := validator.New()
+	if data.ValidateTask(v, task); !v.Valid() {
+		result.Status = http.StatusUnprocessableEntity
+		result.Error = v.Errors
+		return nil
+	}
+
+	e := tasks.Insert(task)
+	if e != nil {
+		return e
+	}
+
+	result.ID = task.ID
+	result.Status = http.StatusCreated
+	result.Task = task
+
+	return nil
+}
+
+func updateTask(tasks data.TaskRepository, id string, patch taskPatch, result *batchResult) error {
+	task, e := tasks.SelectOne(id)
+	if e != nil {
+		switch {
+		case errors.Is(e, data.ErrorRecordNotFound):
+			result.Status = http.StatusNotFound
+			result.Error = "the requested resource could not be found"
+			return nil
+		default:
+			return e
+		}
+	}
+
+	return saveTask(tasks, task, patch, result)
+}
+
+func saveTask(tasks data.TaskRepository, task *data.Task, patch taskPatch, result *batchResult) error {
+	patch.apply(task)
+
+	v := validator.New()
+	if data.ValidateTask(v, task); !v.Valid() {
+		result.Status = http.StatusUnprocessableEntity
+		result.Error = v.Errors
+		return nil
+	}
+
+	e := tasks.Update(task)
+	if e != nil {
+		switch {
+		case errors.Is(e, data.ErrorEditConflict):
+			result.Status = http.StatusConflict
+			result.Error = e.Error()
+			return nil
+		default:
+			return e
+		}
+	}
+
+	result.Status = http.StatusOK
+	result.Task = task
+
+	return nil
+}
+
+func deleteTask(tasks data.TaskRepository, id string, result *batchResult) error {
+	e := tasks.Delete(id)
+	if e != nil {
+		switch {
+		case errors.Is(e, data.ErrorRecordNotFound):
+			result.Status = http.StatusNotFound
+			result.Error = "the requested resource could not be found"
+			return nil
+		default:
+			return e
+		}
+	}
+
+	result.Status = http.StatusOK
+
+	return nil
+}
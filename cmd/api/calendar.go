@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/thomascastle/tarsk/internal/data"
+	"github.com/thomascastle/tarsk/internal/validator"
+)
+
+const icalTimeFormat = "20060102T150405Z"
+
+// maxCalendarTasks caps the tasks of a feed, the ones due first.
+const maxCalendarTasks = 1000
+
+// calendarHandler renders the tasks matching the filters of GET /v1/tasks as
+// an RFC 5545 calendar. Calendar clients subscribe to a URL and cannot send
+// headers, hence the token in the query string.
+func (app *application) calendarHandler(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+
+	if !app.validCalendarToken(values.Get("token")) {
+		app.invalidAuthenticationTokenResponse(w, r)
+		return
+	}
+
+	filters := data.ParseFilters(values)
+	v := validator.New()
+	filters.Validate(v)
+
+	component := app.readString(values, "component", "vevent")
+	v.Check(validator.In(component, "vevent", "vtodo"), "component", "must be vevent or vtodo")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	tasks, e := app.repositories.Tasks.WithContext(r.Context()).SelectFiltered(&filters, maxCalendarTasks)
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+		return
+	}
+
+	var calendar bytes.Buffer
+	writeCalendar(&calendar, strings.ToUpper(component), tasks)
+
+	hash := sha256.Sum256(calendar.Bytes())
+	etag := `"` + hex.EncodeToString(hash[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	if notModified(r, etag, time.Time{}) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", `inline; filename="tasks.ics"`)
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(calendar.Bytes())
+}
+
+// validCalendarToken reports whether token is the configured calendar token.
+// The feed is disabled when no token is configured.
+func (app *application) validCalendarToken(token string) bool {
+	expected := app.config.calendar.token
+	if expected == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// writeCalendar writes a VCALENDAR with one VEVENT or VTODO per task. Events
+// span from started_at to due_at; to-dos start at started_at and are due at
+// due_at. An event needs a start, so a task which has not started starts at
+// its due date, and one without dates is left out of the events. RFC 5545 has
+// no completed status for events, so done only shows on to-dos.
+func writeCalendar(b *bytes.Buffer, component string, tasks []*data.Task) {
+	writeContentLine(b, "BEGIN:VCALENDAR")
+	writeContentLine(b, "VERSION:2.0")
+	writeContentLine(b, "PRODID:-//Tarsk//Tarsk API "+version+"//EN")
+	writeContentLine(b, "CALSCALE:GREGORIAN")
+	writeContentLine(b, "X-WR-CALNAME:Tarsk")
+
+	for _, task := range tasks {
+		if component == "VEVENT" && task.StartedAt.IsZero() && task.DueAt.IsZero() {
+			continue
+		}
+
+		writeContentLine(b, "BEGIN:"+component)
+		writeContentLine(b, "UID:"+task.ID+"@tarsk")
+		writeContentLine(b, "DTSTAMP:"+icalTime(task.UpdatedAt))
+		writeContentLine(b, "CREATED:"+icalTime(task.CreatedAt))
+		writeContentLine(b, "LAST-MODIFIED:"+icalTime(task.UpdatedAt))
+		writeContentLine(b, "SUMMARY:"+icalText(task.Description))
+
+		switch component {
+		case "VEVENT":
+			if task.StartedAt.IsZero() {
+				writeContentLine(b, "DTSTART:"+icalTime(task.DueAt))
+			} else {
+				writeContentLine(b, "DTSTART:"+icalTime(task.StartedAt))
+				if !task.DueAt.IsZero() {
+					writeContentLine(b, "DTEND:"+icalTime(task.DueAt))
+				}
+			}
+		case "VTODO":
+			if !task.StartedAt.IsZero() {
+				writeContentLine(b, "DTSTART:"+icalTime(task.StartedAt))
+			}
+			if !task.DueAt.IsZero() {
+				writeContentLine(b, "DUE:"+icalTime(task.DueAt))
+			}
+			if task.Done {
+				writeContentLine(b, "STATUS:COMPLETED")
+				writeContentLine(b, "PERCENT-COMPLETE:100")
+			} else {
+				writeContentLine(b, "STATUS:NEEDS-ACTION")
+			}
+		}
+
+		writeContentLine(b, "PRIORITY:"+icalPriority(task.Priority))
+		writeContentLine(b, "END:"+component)
+	}
+
+	writeContentLine(b, "END:VCALENDAR")
+}
+
+// writeContentLine writes a line terminated by CRLF, folded so that no line
+// is longer than 75 octets, without splitting UTF-8 sequences.
+func writeContentLine(b *bytes.Buffer, line string) {
+	limit := 75
+	for len(line) > limit {
+		i := limit
+		for i > 0 && !isRuneStart(line[i]) {
+			i--
+		}
+		b.WriteString(line[:i])
+		b.WriteString("\r\n ")
+		line = line[i:]
+		// The leading space of a continuation line counts towards its length.
+		limit = 74
+	}
+
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// icalPriority maps a priority onto the 1 (highest) to 9 (lowest) scale of
+// RFC 5545, where 0 means undefined.
+func icalPriority(priority data.Priority) string {
+	switch priority {
+	case data.PriorityHigh:
+		return "1"
+	case data.PriorityMedium:
+		return "5"
+	case data.PriorityLow:
+		return "9"
+	default:
+		return "0"
+	}
+}
+
+var icalTextReplacer = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+func icalText(s string) string {
+	return icalTextReplacer.Replace(s)
+}
+
+func icalTime(t time.Time) string {
+	return t.UTC().Format(icalTimeFormat)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/thomascastle/tarsk/internal/structuredlog"
+	"github.com/thomascastle/tarsk/internal/validator"
+)
+
+// dbStatsHandler responds with the statistics of the database connection
+// pool shared by the repositories.
+func (app *application) dbStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := app.db.Stats()
+
+	e := app.writeJSON(w, http.StatusOK, envelope{"database": envelope{
+		"idle":                 stats.Idle,
+		"in_use":               stats.InUse,
+		"max_idle_closed":      stats.MaxIdleClosed,
+		"max_idle_time_closed": stats.MaxIdleTimeClosed,
+		"max_lifetime_closed":  stats.MaxLifetimeClosed,
+		"max_open_connections": stats.MaxOpenConnections,
+		"open_connections":     stats.OpenConnections,
+		"wait_count":           stats.WaitCount,
+		"wait_duration_ms":     stats.WaitDuration.Milliseconds(),
+	}}, nil)
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+	}
+}
+
+func (app *application) showLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	e := app.writeJSON(w, http.StatusOK, envelope{"level": app.logger.Level().String()}, nil)
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+	}
+}
+
+// updateLogLevelHandler changes the minimum level of the logged entries
+// without restarting the server, such as to debug a live problem.
+func (app *application) updateLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Level string `json:"level"`
+	}
+
+	e := app.readJSON(w, r, &input)
+	if e != nil {
+		app.badRequestResponse(w, r, e)
+		return
+	}
+
+	level, e := structuredlog.ParseLevel(input.Level)
+
+	v := validator.New()
+	v.Check(input.Level != "", "level", "must be provided")
+	v.Check(input.Level == "" || e == nil, "level", "must be debug, info, warn, error, fatal or off")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	app.logger.Info("log level changed", map[string]any{"from": app.logger.Level(), "to": level})
+	app.logger.SetLevel(level)
+
+	e = app.writeJSON(w, http.StatusOK, envelope{"level": level.String()}, nil)
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+	}
+}
@@ -1,24 +1,76 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 )
 
+// Stable, machine-readable codes identifying the kind of an error.
+const (
+	codeBadRequest                 = "bad_request"
+	codeEditConflict               = "edit_conflict"
+	codeFailedValidation           = "failed_validation"
+	codeIdempotencyKeyInUse        = "idempotency_key_in_use"
+	codeIdempotencyKeyMismatch     = "idempotency_key_mismatch"
+	codeInvalidAuthenticationToken = "invalid_authentication_token"
+	codeRateLimitExceeded          = "rate_limit_exceeded"
+	codeResourceNotFound           = "resource_not_found"
+	codeServerError                = "server_error"
+	codeUnsupportedMediaType       = "unsupported_media_type"
+)
+
+// problem is an RFC 7807 problem details object.
+type problem struct {
+	Code     string            `json:"code"`
+	Detail   string            `json:"detail,omitempty"`
+	Errors   map[string]string `json:"errors,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Status   int               `json:"status"`
+	Title    string            `json:"title"`
+	Type     string            `json:"type"`
+}
+
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, e error) {
-	app.errorResponse(w, r, http.StatusBadRequest, e.Error())
+	app.errorResponse(w, r, http.StatusBadRequest, codeBadRequest, e.Error())
 }
 
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request, e error) {
-	app.errorResponse(w, r, http.StatusBadRequest, e.Error())
+	app.errorResponse(w, r, http.StatusConflict, codeEditConflict, e.Error())
 }
 
-func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
-	e := app.writeJSON(
-		w,
-		status,
-		envelope{"error": message},
-		nil,
-	)
+// errorResponse writes message as {"error": message}, or as a problem+json
+// body when the client accepts application/problem+json. A message which is a
+// map of field errors goes into the errors member of the problem.
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, code string, message interface{}) {
+	var e error
+
+	if acceptsProblem(r) {
+		p := problem{
+			Code:     code,
+			Instance: r.URL.Path,
+			Status:   status,
+			Title:    http.StatusText(status),
+			Type:     "about:blank",
+		}
+
+		switch message := message.(type) {
+		case string:
+			p.Detail = message
+		case map[string]string:
+			p.Detail = "the request contains invalid values"
+			p.Errors = message
+		}
+
+		e = app.writeProblem(w, p)
+	} else {
+		e = app.writeJSON(
+			w,
+			status,
+			envelope{"error": message},
+			nil,
+		)
+	}
 	if e != nil {
 		app.logError(r, e)
 		w.WriteHeader(500)
@@ -26,26 +78,85 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 }
 
 func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
-	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, codeFailedValidation, errors)
 }
 
-func (app *application) resourceNotFoundResponse(w http.ResponseWriter, r *http.Request) {
-	message := "the requested resource could not be found"
-	app.errorResponse(w, r, http.StatusNotFound, message)
+func (app *application) idempotencyKeyInUseResponse(w http.ResponseWriter, r *http.Request) {
+	message := "a request with the same idempotency key is still being processed"
+	app.errorResponse(w, r, http.StatusConflict, codeIdempotencyKeyInUse, message)
+}
+
+func (app *application) idempotencyKeyMismatchResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the idempotency key was already used with a different request"
+	app.errorResponse(w, r, http.StatusUnprocessableEntity, codeIdempotencyKeyMismatch, message)
+}
+
+func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or missing authentication token"
+	app.errorResponse(w, r, http.StatusUnauthorized, codeInvalidAuthenticationToken, message)
 }
 
 func (app *application) logError(r *http.Request, e error) {
-	app.logger.Error(e, map[string]string{"request_method": r.Method, "request_url": r.URL.String()})
+	app.logger.Error(e, map[string]any{"request_id": requestID(r), "request_method": r.Method, "request_url": loggedURL(r)})
+}
+
+// loggedURL returns the URL of a request as logged, without the value of its
+// token parameter, which authenticates calendar subscriptions.
+func loggedURL(r *http.Request) string {
+	values := r.URL.Query()
+	if !values.Has("token") {
+		return r.URL.String()
+	}
+
+	values.Set("token", "REDACTED")
+
+	u := *r.URL
+	u.RawQuery = values.Encode()
+
+	return u.String()
+}
+
+// logPanic logs a recovered panic with its stack, whatever the stack level of
+// the logger.
+func (app *application) logPanic(r *http.Request, e interface{}, stack []byte) {
+	app.logger.Error(fmt.Errorf("panic: %v", e), map[string]any{
+		"request_id":     requestID(r),
+		"request_method": r.Method,
+		"request_url":    loggedURL(r),
+		"stack":          string(stack),
+	})
 }
 
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeded"
-	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+	app.errorResponse(w, r, http.StatusTooManyRequests, codeRateLimitExceeded, message)
+}
+
+func (app *application) resourceNotFoundResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the requested resource could not be found"
+	app.errorResponse(w, r, http.StatusNotFound, codeResourceNotFound, message)
 }
 
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, e error) {
 	app.logError(r, e)
 
 	message := "the server encountered a problem and could not process your request"
-	app.errorResponse(w, r, http.StatusInternalServerError, message)
+	app.errorResponse(w, r, http.StatusInternalServerError, codeServerError, message)
+}
+
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the request body is in an unsupported format"
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, message)
+}
+
+// acceptsProblem reports whether the Accept header asks for problem+json.
+func acceptsProblem(r *http.Request) bool {
+	for _, value := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(value, ";")
+		if strings.TrimSpace(mediaType) == "application/problem+json" {
+			return true
+		}
+	}
+
+	return false
 }
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoggedURLRedactsToken(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"/v1/calendar.ics?token=s3cret&done=false", "/v1/calendar.ics?done=false&token=REDACTED"},
+		{"/v1/tasks?done=false", "/v1/tasks?done=false"},
+	}
+
+	for _, test := range tests {
+		if got := loggedURL(httptest.NewRequest("GET", test.url, nil)); got != test.want {
+			t.Errorf("loggedURL(%s) = %s, want %s", test.url, got, test.want)
+		}
+	}
+}
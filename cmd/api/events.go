@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thomascastle/tarsk/internal/data"
+	"github.com/thomascastle/tarsk/internal/messaging"
+	"github.com/thomascastle/tarsk/internal/validator"
+)
+
+const (
+	eventsBacklogPageSize   = 100
+	eventsHeartbeatInterval = 15 * time.Second
+)
+
+var eventIDPattern = regexp.MustCompile(`^\d+-\d+$`)
+
+// eventsHandler streams task events as Server-Sent Events, as received by the
+// event hub. A client which reconnects with a Last-Event-ID header first
+// receives the events it missed, as far as they are still kept in the event
+// stream.
+func (app *application) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+
+	var priorities []data.Priority
+	for _, value := range strings.Split(app.readString(values, "priority", ""), ",") {
+		if value != "" {
+			priorities = append(priorities, data.Priority(strings.TrimSpace(value)))
+		}
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = app.readString(values, "last_event_id", "")
+	}
+
+	v := validator.New()
+	for _, priority := range priorities {
+		v.Check(priority.Valid(), "priority", "invalid value")
+	}
+	v.Check(lastEventID == "" || eventIDPattern.MatchString(lastEventID), "last_event_id", "invalid value")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-app.shutdown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// The events published while the missed ones are read from the stream
+	// wait in the subscription.
+	events := app.hub.subscribe()
+	defer app.hub.unsubscribe(events)
+
+	// The stream outlives the server's WriteTimeout.
+	rc := http.NewResponseController(w)
+	if e := rc.SetWriteDeadline(time.Time{}); e != nil {
+		app.serverErrorResponse(w, r, e)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", (3 * time.Second).Milliseconds())
+	if e := rc.Flush(); e != nil {
+		return
+	}
+
+	for lastEventID != "" {
+		missed, e := app.messageBrokerage.EventsAfter(ctx, lastEventID, eventsBacklogPageSize)
+		if e != nil {
+			if !errors.Is(e, context.Canceled) {
+				app.logError(r, e)
+			}
+			return
+		}
+
+		for _, event := range missed {
+			lastEventID = event.ID
+			writeEvent(w, event, priorities)
+		}
+
+		if e := rc.Flush(); e != nil {
+			return
+		}
+
+		if len(missed) < eventsBacklogPageSize {
+			break
+		}
+	}
+
+	heartbeat := time.NewTicker(eventsHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case event, ok := <-events:
+			// The client fell behind and resumes from the last event it
+			// got when reconnecting.
+			if !ok {
+				return
+			}
+			// Skip the events already sent from the stream.
+			if lastEventID != "" && !eventIDAfter(event.ID, lastEventID) {
+				continue
+			}
+			lastEventID = event.ID
+			writeEvent(w, event, priorities)
+		}
+
+		if e := rc.Flush(); e != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event messaging.Event, priorities []data.Priority) {
+	payload, ok := eventPayload(event, priorities)
+	if !ok {
+		return
+	}
+
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, payload)
+}
+
+// eventIDAfter reports whether the stream entry ID a follows b. IDs are made
+// of a millisecond timestamp and a sequence number, as in 1700000000000-0.
+func eventIDAfter(a, b string) bool {
+	aTime, aSequence := splitEventID(a)
+	bTime, bSequence := splitEventID(b)
+
+	return aTime > bTime || aTime == bTime && aSequence > bSequence
+}
+
+func splitEventID(id string) (uint64, uint64) {
+	timestamp, sequence, _ := strings.Cut(id, "-")
+	t, _ := strconv.ParseUint(timestamp, 10, 64)
+	n, _ := strconv.ParseUint(sequence, 10, 64)
+
+	return t, n
+}
+
+// eventPayload returns the data of an event, or false when the event is
+// filtered out by priority. Deletions carry no priority and are always sent.
+func eventPayload(event messaging.Event, priorities []data.Priority) ([]byte, bool) {
+	switch event.Type {
+	case "created", "updated":
+		var task data.Task
+		if e := json.Unmarshal([]byte(event.Payload), &task); e != nil {
+			return nil, false
+		}
+		if len(priorities) > 0 && !containsPriority(priorities, task.Priority) {
+			return nil, false
+		}
+		payload, e := json.Marshal(task)
+		return payload, e == nil
+	case "deleted":
+		var id string
+		if e := json.Unmarshal([]byte(event.Payload), &id); e != nil {
+			return nil, false
+		}
+		payload, e := json.Marshal(map[string]string{"id": id})
+		return payload, e == nil
+	default:
+		return nil, false
+	}
+}
+
+func containsPriority(priorities []data.Priority, priority data.Priority) bool {
+	for _, p := range priorities {
+		if p == priority {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const probeTimeout = 2 * time.Second
+
+// dependencyStatus is the outcome of probing a dependency.
+type dependencyStatus struct {
+	Error     string `json:"error,omitempty"`
+	LatencyMS int64  `json:"latency_ms"`
+	Status    string `json:"status"`
+}
+
+func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
+	data := envelope{
+		"status": "available",
+		"system_info": map[string]string{
+			"environment": app.config.env,
+			"version":     version,
+		},
+		"uptime": time.Since(app.started).Round(time.Second).String(),
+	}
+
+	e := app.writeJSON(w, http.StatusOK, data, nil)
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+	}
+}
+
+// livenessHandler reports that the process serves requests. It does not probe
+// the dependencies: an outage of one of them is not cured by restarting the
+// service, which readiness accounts for instead.
+func (app *application) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	e := app.writeJSON(w, http.StatusOK, envelope{"status": "ok"}, nil)
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+	}
+}
+
+// readinessHandler probes Postgres, Redis and Elasticsearch concurrently and
+// answers 503 if any of them is down or if the server is shutting down, so
+// that no more traffic is routed to it.
+func (app *application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	probes := map[string]func(ctx context.Context) error{
+		"elasticsearch": app.probeElasticsearch,
+		"postgres":      app.db.PingContext,
+		"redis": func(ctx context.Context) error {
+			return app.redisClient.Ping(ctx).Err()
+		},
+	}
+
+	dependencies := make(map[string]dependencyStatus, len(probes))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, probe := range probes {
+		wg.Add(1)
+		go func(name string, probe func(ctx context.Context) error) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(r.Context(), probeTimeout)
+			defer cancel()
+
+			start := time.Now()
+			e := probe(ctx)
+
+			status := dependencyStatus{LatencyMS: time.Since(start).Milliseconds(), Status: "up"}
+			if e != nil {
+				status.Error = e.Error()
+				status.Status = "down"
+			}
+
+			mu.Lock()
+			dependencies[name] = status
+			mu.Unlock()
+		}(name, probe)
+	}
+	wg.Wait()
+
+	ready := !app.shuttingDown.Load()
+	for _, dependency := range dependencies {
+		if dependency.Status != "up" {
+			ready = false
+		}
+	}
+
+	data := envelope{"dependencies": dependencies, "status": "ready"}
+	status := http.StatusOK
+	if !ready {
+		data["status"] = "not_ready"
+		status = http.StatusServiceUnavailable
+	}
+	if app.shuttingDown.Load() {
+		data["status"] = "shutting_down"
+	}
+
+	e := app.writeJSON(w, status, data, nil)
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+	}
+}
+
+func (app *application) probeElasticsearch(ctx context.Context) error {
+	response, e := app.searchClient.Ping(app.searchClient.Ping.WithContext(ctx))
+	if e != nil {
+		return e
+	}
+	defer response.Body.Close()
+
+	if response.IsError() {
+		return fmt.Errorf("unexpected response status: %s", response.Status())
+	}
+
+	return nil
+}
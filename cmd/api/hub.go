@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/thomascastle/tarsk/internal/messaging"
+)
+
+// eventHubBufferSize is the number of events a subscriber may fall behind by.
+const eventHubBufferSize = 64
+
+// eventHub reads the task event stream once and fans the events out to every
+// subscriber, so that long-lived connections share a single Redis reader.
+type eventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan messaging.Event]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		subscribers: make(map[chan messaging.Event]struct{}),
+	}
+}
+
+// subscribe returns a channel receiving the events broadcast from now on. The
+// channel is closed once the subscriber falls behind and misses an event, so
+// that it can catch up from the stream instead.
+func (h *eventHub) subscribe() chan messaging.Event {
+	ch := make(chan messaging.Event, eventHubBufferSize)
+
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan messaging.Event) {
+	h.mu.Lock()
+	delete(h.subscribers, ch)
+	h.mu.Unlock()
+}
+
+// broadcast hands the event to every subscriber. A subscriber whose buffer is
+// full is dropped, its channel closed, rather than holding up the others.
+func (h *eventHub) broadcast(event messaging.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// runEventHub feeds app.hub from the event stream until ctx is done.
+func (app *application) runEventHub(ctx context.Context) {
+	lastEventID := ""
+
+	for ctx.Err() == nil {
+		var e error
+
+		if lastEventID == "" {
+			lastEventID, e = app.messageBrokerage.LastEventID(ctx)
+		}
+
+		var events []messaging.Event
+		if e == nil {
+			events, e = app.messageBrokerage.ReadEvents(ctx, lastEventID, 15*time.Second)
+		}
+		if e != nil {
+			if ctx.Err() == nil {
+				app.logger.Error(e, nil)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		for _, event := range events {
+			lastEventID = event.ID
+			app.hub.broadcast(event)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/thomascastle/tarsk/internal/messaging"
+)
+
+func TestEventHubDropsSlowSubscriber(t *testing.T) {
+	hub := newEventHub()
+
+	slow := hub.subscribe()
+	defer hub.unsubscribe(slow)
+
+	fast := hub.subscribe()
+	defer hub.unsubscribe(fast)
+
+	for i := 0; i <= eventHubBufferSize; i++ {
+		hub.broadcast(messaging.Event{ID: strconv.Itoa(i) + "-0"})
+
+		if event := <-fast; event.ID != strconv.Itoa(i)+"-0" {
+			t.Fatalf("fast subscriber got %s, want %d-0", event.ID, i)
+		}
+	}
+
+	// The buffered events are still received before the channel is closed.
+	for i := 0; i < eventHubBufferSize; i++ {
+		if event, ok := <-slow; !ok || event.ID != strconv.Itoa(i)+"-0" {
+			t.Fatalf("slow subscriber got %s, %v, want %d-0", event.ID, ok, i)
+		}
+	}
+	if event, ok := <-slow; ok {
+		t.Fatalf("slow subscriber got %s, want its channel closed", event.ID)
+	}
+
+	hub.broadcast(messaging.Event{ID: "next-0"})
+	if event := <-fast; event.ID != "next-0" {
+		t.Errorf("fast subscriber got %s, want next-0", event.ID)
+	}
+}
@@ -1,66 +1,145 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"flag"
+	"log/slog"
 	"os"
+	"sync/atomic"
+	"time"
 
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/go-redis/redis/v8"
 	_ "github.com/lib/pq"
+	"github.com/thomascastle/tarsk/internal/config"
 	"github.com/thomascastle/tarsk/internal/data"
 	"github.com/thomascastle/tarsk/internal/messaging"
+	"github.com/thomascastle/tarsk/internal/metrics"
 	"github.com/thomascastle/tarsk/internal/search"
 	"github.com/thomascastle/tarsk/internal/structuredlog"
+	"github.com/thomascastle/tarsk/internal/tracing"
+	"github.com/thomascastle/tarsk/internal/validator"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+const version = "1.0.0"
+
 type configuration struct {
+	calendar struct {
+		token string
+	}
 	db struct {
-		dsn string
+		dsn          string
+		maxIdleConns int
+		maxIdleTime  time.Duration
+		maxLifetime  time.Duration
+		maxOpenConns int
+	}
+	debug struct {
+		enabled bool
+	}
+	elasticsearch search.Config
+	env           string
+	idempotency   struct {
+		lease time.Duration
+		ttl   time.Duration
 	}
-	env     string
 	limiter struct {
 		burst   int
 		enabled bool
 		rps     float64
 	}
-	port int
+	log      structuredlog.Config
+	port     int
+	redis    messaging.Config
+	shutdown struct {
+		delay time.Duration
+	}
+	tracing tracing.Config
 }
 
 type application struct {
 	config              configuration
+	db                  *sql.DB
+	hub                 *eventHub
 	logger              *structuredlog.Logger
 	messageBrokerage    *messaging.TaskMessageBrokerage
+	metrics             apiMetrics
+	redisClient         *redis.Client
+	registry            *metrics.Registry
 	repositories        data.Repositories
 	search              data.Search
+	searchClient        *elasticsearch.Client
+	shutdown            chan struct{}
+	shuttingDown        atomic.Bool
+	started             time.Time
 	taskIndexRepository data.TaskIndexRepository
+	tracer              *tracing.Tracer
 }
 
 func main() {
-	var config configuration
+	var cfg configuration
+
+	flag.StringVar(&cfg.calendar.token, "calendar-token", "", "Token of the iCalendar feed, which is disabled when empty")
+
+	flag.StringVar(&cfg.db.dsn, "db-dsn", "", "Data Source Name")
+	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 25, "Maximum idle connections in the pool")
+	flag.DurationVar(&cfg.db.maxIdleTime, "db-max-idle-time", 15*time.Minute, "Maximum time a connection may be idle")
+	flag.DurationVar(&cfg.db.maxLifetime, "db-max-lifetime", time.Hour, "Maximum time a connection may be reused")
+	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 25, "Maximum open connections in the pool")
+
+	flag.BoolVar(&cfg.debug.enabled, "debug-enabled", false, "Serve the /v1/debug endpoints, which expose the internals of the server")
+
+	config.Elasticsearch(flag.CommandLine, &cfg.elasticsearch)
 
-	flag.StringVar(&config.db.dsn, "db-dsn", "", "Data Source Name")
+	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
 
-	flag.StringVar(&config.env, "env", "development", "Environment (development|staging|production)")
+	flag.DurationVar(&cfg.idempotency.lease, "idempotency-lease", time.Minute, "How long a request holds its Idempotency-Key before a retry may take it over")
+	flag.DurationVar(&cfg.idempotency.ttl, "idempotency-ttl", 24*time.Hour, "How long responses are kept for an Idempotency-Key")
 
-	flag.IntVar(&config.limiter.burst, "limiter-burst", 4, "Maximum burst")
-	flag.BoolVar(&config.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
-	flag.Float64Var(&config.limiter.rps, "limiter-rps", 2, "Maximum requests per second")
+	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Maximum burst")
+	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
+	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Maximum requests per second")
 
-	flag.IntVar(&config.port, "port", 4000, "Port number the server is listening on")
+	config.Logging(flag.CommandLine, &cfg.log)
 
-	flag.Parse()
+	flag.IntVar(&cfg.port, "port", 4000, "Port number the server is listening on")
+
+	config.Redis(flag.CommandLine, &cfg.redis)
+
+	flag.DurationVar(&cfg.shutdown.delay, "shutdown-delay", 0, "How long readiness fails before the server stops accepting connections on shutdown")
+
+	config.Tracing(flag.CommandLine, &cfg.tracing)
 
 	logger := structuredlog.New(os.Stdout, structuredlog.LevelInfo)
 
-	r_client, e := messaging.NewClient()
+	e := config.Parse(flag.CommandLine, os.Args[1:])
+	if errors.Is(e, config.ErrorPrintedConfig) {
+		os.Exit(0)
+	}
+	if e != nil {
+		logger.Fatal(e, nil)
+	}
+
+	v := validator.New()
+	if validateConfiguration(v, cfg); !v.Valid() {
+		logger.Fatal(errors.New("invalid configuration"), map[string]any{"errors": v.Errors})
+	}
+
+	logger.Configure(cfg.log)
+	slog.SetDefault(slog.New(logger.Handler()))
+
+	r_client, e := messaging.NewClient(cfg.redis)
 	if e != nil {
 		logger.Fatal(e, nil)
 	}
 
 	logger.Info("messaging client created", nil)
 
-	db, e := openDB(config)
+	db, e := openDB(cfg)
 	if e != nil {
 		logger.Fatal(e, nil)
 	}
@@ -68,25 +147,42 @@ func main() {
 
 	logger.Info("database connection pool established", nil)
 
-	s_client, e := search.NewClient()
+	s_client, e := search.NewClient(cfg.elasticsearch)
 	if e != nil {
 		logger.Fatal(e, nil)
 	}
 
 	logger.Info("search client created", nil)
 
-	db_GORM, e := openDB_GORM(config)
+	db_GORM, e := openDB_GORM(db)
+	if e != nil {
+		logger.Fatal(e, nil)
+	}
+
+	tracer, exporter, e := tracing.NewTracerFromConfig("tarsk-api", cfg.tracing)
 	if e != nil {
 		logger.Fatal(e, nil)
 	}
+	defer exporter.Close()
+
+	registry := metrics.NewRegistry()
 
 	app := &application{
-		config:              config,
+		config:              cfg,
+		db:                  db,
+		hub:                 newEventHub(),
 		logger:              logger,
-		messageBrokerage:    messaging.NewTaskMessageBrokerage(r_client),
+		messageBrokerage:    messaging.NewTaskMessageBrokerage(r_client, registry),
+		metrics:             newAPIMetrics(registry, db),
+		redisClient:         r_client,
+		registry:            registry,
 		repositories:        data.NewRepositories(db),
-		search:              *data.NewSearch(s_client),
+		search:              *data.NewSearch(s_client, cfg.elasticsearch.Index),
+		searchClient:        s_client,
+		shutdown:            make(chan struct{}),
+		started:             time.Now(),
 		taskIndexRepository: data.NewTaskIndexRepository(db_GORM),
+		tracer:              tracer,
 	}
 
 	e = app.serve()
@@ -95,13 +191,47 @@ func main() {
 	}
 }
 
+func validateConfiguration(v *validator.Validator, cfg configuration) {
+	v.Check(cfg.db.dsn != "", "db-dsn", "is required")
+	v.Check(cfg.db.maxIdleConns >= 0, "db-max-idle-conns", "must not be negative")
+	v.Check(cfg.db.maxIdleTime >= 0, "db-max-idle-time", "must not be negative")
+	v.Check(cfg.db.maxLifetime >= 0, "db-max-lifetime", "must not be negative")
+	v.Check(cfg.db.maxOpenConns >= 0, "db-max-open-conns", "must not be negative, 0 meaning unlimited")
+
+	config.ValidateElasticsearch(v, cfg.elasticsearch)
+
+	v.Check(validator.In(cfg.env, "development", "staging", "production"), "env", "must be development, staging or production")
+
+	v.Check(cfg.idempotency.lease > 0, "idempotency-lease", "must be greater than zero")
+	v.Check(cfg.idempotency.ttl > 0, "idempotency-ttl", "must be greater than zero")
+
+	if cfg.limiter.enabled {
+		v.Check(cfg.limiter.burst > 0, "limiter-burst", "must be greater than zero")
+		v.Check(cfg.limiter.rps > 0, "limiter-rps", "must be greater than zero")
+	}
+
+	v.Check(cfg.port > 0 && cfg.port <= 65535, "port", "must be between 1 and 65535")
+
+	config.ValidateRedis(v, cfg.redis)
+
+	v.Check(cfg.shutdown.delay >= 0, "shutdown-delay", "must not be negative")
+}
+
 func openDB(config configuration) (*sql.DB, error) {
 	db, e := sql.Open("postgres", config.db.dsn)
 	if e != nil {
 		return nil, e
 	}
 
-	e = db.Ping()
+	db.SetConnMaxIdleTime(config.db.maxIdleTime)
+	db.SetConnMaxLifetime(config.db.maxLifetime)
+	db.SetMaxIdleConns(config.db.maxIdleConns)
+	db.SetMaxOpenConns(config.db.maxOpenConns)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	e = db.PingContext(ctx)
 	if e != nil {
 		return nil, e
 	}
@@ -109,12 +239,13 @@ func openDB(config configuration) (*sql.DB, error) {
 	return db, nil
 }
 
-func openDB_GORM(config configuration) (*gorm.DB, error) {
-	dsn := config.db.dsn
-	db, e := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+// openDB_GORM wraps the pool of db, so that both share its connections and
+// limits.
+func openDB_GORM(db *sql.DB) (*gorm.DB, error) {
+	db_GORM, e := gorm.Open(postgres.New(postgres.Config{Conn: db}), &gorm.Config{})
 	if e != nil {
 		return nil, e
 	}
 
-	return db, nil
+	return db_GORM, nil
 }
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/thomascastle/tarsk/internal/metrics"
+	"github.com/thomascastle/tarsk/internal/tracing"
+)
+
+type apiMetrics struct {
+	rateLimited     *metrics.Counter
+	requestDuration *metrics.Histogram
+	requests        *metrics.Counter
+}
+
+// newAPIMetrics registers the metrics of the API, including the statistics of
+// the database connection pool, which are read when scraped.
+func newAPIMetrics(registry *metrics.Registry, db *sql.DB) apiMetrics {
+	registry.GaugeFunc("tarsk_db_connections_idle", "Idle database connections.", func() float64 {
+		return float64(db.Stats().Idle)
+	})
+	registry.GaugeFunc("tarsk_db_connections_in_use", "Database connections in use.", func() float64 {
+		return float64(db.Stats().InUse)
+	})
+	registry.GaugeFunc("tarsk_db_connections_max_open", "Maximum open database connections, 0 meaning unlimited.", func() float64 {
+		return float64(db.Stats().MaxOpenConnections)
+	})
+	registry.GaugeFunc("tarsk_db_connections_open", "Open database connections.", func() float64 {
+		return float64(db.Stats().OpenConnections)
+	})
+	registry.CounterFunc("tarsk_db_connections_closed_max_idle_total", "Database connections closed because of the maximum of idle connections.", func() float64 {
+		return float64(db.Stats().MaxIdleClosed)
+	})
+	registry.CounterFunc("tarsk_db_connections_closed_max_idle_time_total", "Database connections closed because of the maximum idle time.", func() float64 {
+		return float64(db.Stats().MaxIdleTimeClosed)
+	})
+	registry.CounterFunc("tarsk_db_connections_closed_max_lifetime_total", "Database connections closed because of the maximum lifetime.", func() float64 {
+		return float64(db.Stats().MaxLifetimeClosed)
+	})
+	registry.CounterFunc("tarsk_db_waits_total", "Times a database connection was waited for.", func() float64 {
+		return float64(db.Stats().WaitCount)
+	})
+	registry.CounterFunc("tarsk_db_wait_seconds_total", "Time spent waiting for database connections.", func() float64 {
+		return db.Stats().WaitDuration.Seconds()
+	})
+
+	return apiMetrics{
+		rateLimited:     registry.Counter("tarsk_http_rate_limited_total", "Requests rejected by the rate limiter."),
+		requestDuration: registry.Histogram("tarsk_http_request_duration_seconds", "Latency of the requests.", metrics.DefaultBuckets, "method", "route", "status"),
+		requests:        registry.Counter("tarsk_http_requests_total", "Requests served.", "method", "route", "status"),
+	}
+}
+
+func (app *application) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	app.registry.Handler().ServeHTTP(w, r)
+}
+
+// instrument counts the requests of a route, observes their latency and
+// traces them, continuing the trace of their traceparent header. The route,
+// rather than the requested path, labels them so that the number of series
+// is bounded.
+func (app *application) instrument(method, route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		if matched, ok := r.Context().Value(routeContextKey).(*string); ok {
+			*matched = route
+		}
+
+		ctx := tracing.ContextWithRemoteParent(r.Context(), r.Header.Get("traceparent"))
+		ctx, span := app.tracer.Start(ctx, method+" "+route)
+		span.SetAttribute("http.method", method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("request_id", requestID(r))
+
+		next(recorder, r.WithContext(ctx))
+
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		status := strconv.Itoa(recorder.status)
+
+		span.SetAttribute("http.status_code", status)
+		if recorder.status >= http.StatusInternalServerError {
+			span.RecordError(errors.New(http.StatusText(recorder.status)))
+		}
+		span.End()
+
+		app.metrics.requests.Inc(method, route, status)
+		app.metrics.requestDuration.Observe(time.Since(start).Seconds(), method, route, status)
+	}
+}
+
+// statusRecorder records the status and size of a response. It passes flushes
+// and hijacks through, as event streams and WebSockets need them.
+type statusRecorder struct {
+	http.ResponseWriter
+	bytes  int
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+
+	n, e := s.ResponseWriter.Write(b)
+	s.bytes += n
+
+	return n, e
+}
+
+func (s *statusRecorder) Flush() {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	http.NewResponseController(s.ResponseWriter).Flush()
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("the response does not support hijacking")
+	}
+
+	s.status = http.StatusSwitchingProtocols
+
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
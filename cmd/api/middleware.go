@@ -1,14 +1,134 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
 	"net/http"
+	"runtime/debug"
 	"sync"
 	"time"
 
+	"github.com/thomascastle/tarsk/internal/messaging"
+	"github.com/thomascastle/tarsk/internal/tracing"
+
 	"github.com/tomasen/realip"
 	"golang.org/x/time/rate"
 )
 
+type contextKey string
+
+const routeContextKey = contextKey("route")
+
+// logRequest assigns each request an ID, taken from its X-Request-ID header
+// when it has a valid one, echoes it in the response and logs the request
+// once it is served. The ID is carried by the request context, so that events
+// published while serving the request are correlated with it.
+func (app *application) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		// The route is only known once the router has matched the request,
+		// so instrument fills it in.
+		route := new(string)
+
+		ctx := messaging.WithRequestID(r.Context(), id)
+		ctx = context.WithValue(ctx, routeContextKey, route)
+
+		recorder := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		app.logger.Info("request served", map[string]any{
+			"bytes":          recorder.bytes,
+			"client_ip":      realip.FromRequest(r),
+			"duration":       time.Since(start),
+			"request_id":     id,
+			"request_method": r.Method,
+			"route":          *route,
+			"status":         status,
+		})
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// requestID returns the ID assigned to a request by logRequest.
+func requestID(r *http.Request) string {
+	return messaging.RequestID(r.Context())
+}
+
+// eventContext returns the context to publish the events caused by a request
+// with. It carries the ID and the span of the request but, unlike the request
+// context, is not canceled when the client goes away.
+func eventContext(r *http.Request) context.Context {
+	ctx := tracing.ContextWithSpan(context.Background(), tracing.SpanFromContext(r.Context()))
+
+	return messaging.WithRequestID(ctx, requestID(r))
+}
+
+// recoverPanic turns a panic in a handler into a server error response, logged
+// along with the request ID and the stack of the panic. The connection is
+// closed, as the panic may have left it in an unknown state.
+func (app *application) recoverPanic(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			e := recover()
+			if e == nil {
+				return
+			}
+
+			// http.ErrAbortHandler deliberately aborts the response, which
+			// the server handles without logging.
+			if e == http.ErrAbortHandler {
+				panic(e)
+			}
+
+			app.logPanic(r, e, debug.Stack())
+
+			w.Header().Set("Connection", "close")
+			message := "the server encountered a problem and could not process your request"
+			app.errorResponse(w, r, http.StatusInternalServerError, codeServerError, message)
+		}()
+
+		next(w, r)
+	}
+}
+
 func (app *application) rate(next http.Handler) http.Handler {
 	type client struct {
 		limiter  *rate.Limiter
@@ -50,6 +170,7 @@ func (app *application) rate(next http.Handler) http.Handler {
 
 			if !clients[ip_addr].limiter.Allow() {
 				mu.Unlock()
+				app.metrics.rateLimited.Inc()
 				app.rateLimitExceededResponse(w, r)
 				return
 			}
@@ -60,3 +181,117 @@ func (app *application) rate(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// idempotent replays the stored response when a request is repeated with the
+// same Idempotency-Key header, so that retried requests take effect only once.
+// A request holds its key for the idempotency lease only, after which a retry
+// takes the key over if no response was stored.
+func (app *application) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		if len(key) > 255 {
+			app.badRequestResponse(w, r, errors.New("Idempotency-Key header must not be more than 255 bytes long"))
+			return
+		}
+
+		body, e := io.ReadAll(io.LimitReader(r.Body, 1_048_577))
+		if e != nil {
+			app.badRequestResponse(w, r, e)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+		hash.Write(body)
+		fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+		record, reserved, e := app.repositories.Idempotency.Reserve(key, fingerprint, app.config.idempotency.lease, app.config.idempotency.ttl)
+		if e != nil {
+			app.serverErrorResponse(w, r, e)
+			return
+		}
+
+		if !reserved {
+			switch {
+			case record.Fingerprint != fingerprint:
+				app.idempotencyKeyMismatchResponse(w, r)
+			case record.ResponseStatus == 0:
+				app.idempotencyKeyInUseResponse(w, r)
+			default:
+				for key, value := range record.ResponseHeaders {
+					w.Header()[key] = value
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(record.ResponseStatus)
+				w.Write(record.ResponseBody)
+			}
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w}
+
+		completed := false
+		defer func() {
+			if !completed {
+				if e := app.repositories.Idempotency.Release(record); e != nil {
+					app.logError(r, e)
+				}
+			}
+		}()
+
+		next(recorder, r)
+
+		// Server errors are not stored, and the key is released, so that the
+		// request can be retried.
+		if recorder.status == 0 || recorder.status >= http.StatusInternalServerError {
+			return
+		}
+
+		headers := make(map[string][]string)
+		for _, key := range []string{"Content-Type", "Location"} {
+			if value, found := recorder.Header()[key]; found {
+				headers[key] = value
+			}
+		}
+
+		record.ResponseBody = recorder.body.Bytes()
+		record.ResponseHeaders = headers
+		record.ResponseStatus = recorder.status
+
+		e = app.repositories.Idempotency.Complete(record)
+		if e != nil {
+			app.logError(r, e)
+			return
+		}
+
+		completed = true
+	}
+}
+
+// responseRecorder keeps a copy of the status and body written to the
+// underlying ResponseWriter.
+type responseRecorder struct {
+	http.ResponseWriter
+	body   bytes.Buffer
+	status int
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+
+	return rec.ResponseWriter.Write(b)
+}
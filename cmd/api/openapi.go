@@ -0,0 +1,778 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/thomascastle/tarsk/internal/data"
+)
+
+type object = map[string]interface{}
+
+// operations describes every route of routeTable, keyed by method and path.
+func (app *application) operations() map[string]object {
+	taskParameters := []object{
+		pathParameter("id", "ID of the task"),
+		queryParameter("fields", stringSchema(), "Comma-separated list of the fields to return: "+strings.Join(data.TaskFields, ", ")),
+	}
+
+	return map[string]object{
+		"GET /v1/calendar.ics": {
+			"summary":     "Render tasks as an iCalendar feed",
+			"description": "Tasks span from started_at to due_at. Priorities map to PRIORITY 1 (high), 5 (medium), 9 (low) or 0 (none); done to-dos have STATUS:COMPLETED.",
+			"parameters": append([]object{
+				queryParameter("token", stringSchema(), "Token of the feed, as configured with -calendar-token"),
+				queryParameter("component", object{"type": "string", "enum": []string{"vevent", "vtodo"}, "default": "vevent"}, "Whether tasks are rendered as events or to-dos"),
+			}, filterParameters()...),
+			"responses": withErrors(object{
+				"200": object{
+					"description": "The calendar",
+					"content": object{
+						"text/calendar": object{"schema": stringSchema()},
+					},
+				},
+				"304": object{"description": "The calendar has not changed"},
+			}, http.StatusUnauthorized, http.StatusUnprocessableEntity),
+		},
+		"GET /v1/debug/db": {
+			"summary":     "Show the statistics of the database connection pool",
+			"description": "Only served when the server runs with -debug-enabled.",
+			"responses": withErrors(object{
+				"200": object{
+					"description": "The statistics, as reported by database/sql",
+					"content": jsonContent(object{
+						"type": "object",
+						"properties": object{
+							"database": object{
+								"type":                 "object",
+								"additionalProperties": object{"type": "integer"},
+							},
+						},
+					}),
+				},
+			}),
+		},
+		"GET /v1/debug/log-level": {
+			"summary":     "Show the minimum level of the logged entries",
+			"description": "Only served when the server runs with -debug-enabled.",
+			"responses": withErrors(object{
+				"200": object{
+					"description": "The level",
+					"content":     jsonContent(ref("LogLevel")),
+				},
+			}),
+		},
+		"PUT /v1/debug/log-level": {
+			"summary":     "Change the minimum level of the logged entries",
+			"description": "Only served when the server runs with -debug-enabled.",
+			"requestBody": requestBody(ref("LogLevel")),
+			"responses": withErrors(object{
+				"200": object{
+					"description": "The new level",
+					"content":     jsonContent(ref("LogLevel")),
+				},
+			}, http.StatusBadRequest, http.StatusUnprocessableEntity),
+		},
+		"GET /v1/events": {
+			"summary": "Stream task events as Server-Sent Events",
+			"parameters": []object{
+				queryParameter("priority", stringSchema(), "Comma-separated list of priorities of the created and updated tasks to stream"),
+				queryParameter("last_event_id", stringSchema(), "Resume after this event, like the Last-Event-ID header"),
+				{
+					"name":        "Last-Event-ID",
+					"in":          "header",
+					"description": "Resume after this event",
+					"schema":      stringSchema(),
+				},
+			},
+			"responses": withErrors(object{
+				"200": object{
+					"description": "Events named created, updated or deleted; the data is the task, or its id for deletions",
+					"content": object{
+						"text/event-stream": object{"schema": stringSchema()},
+					},
+				},
+			}, http.StatusUnprocessableEntity),
+		},
+		"GET /v1/healthcheck": {
+			"summary": "Show the status, version, environment and uptime of the service",
+			"responses": withErrors(object{
+				"200": object{
+					"description": "The service is available",
+					"content": jsonContent(object{
+						"type": "object",
+						"properties": object{
+							"status": stringSchema(),
+							"system_info": object{
+								"type": "object",
+								"properties": object{
+									"environment": stringSchema(),
+									"version":     stringSchema(),
+								},
+							},
+							"uptime": stringSchema(),
+						},
+					}),
+				},
+			}),
+		},
+		"GET /livez": {
+			"summary":     "Liveness probe",
+			"description": "Succeeds as long as the process serves requests; dependencies are not probed.",
+			"responses": withErrors(object{
+				"200": object{"description": "The process is alive"},
+			}),
+		},
+		"GET /metrics": {
+			"summary":     "Metrics in the Prometheus text format",
+			"description": "Requests and their latency per route and status, rate limiter rejections, database connection pool statistics and published events.",
+			"responses": withErrors(object{
+				"200": object{
+					"description": "The metrics",
+					"content": object{
+						"text/plain": object{"schema": stringSchema()},
+					},
+				},
+			}),
+		},
+		"GET /readyz": {
+			"summary":     "Readiness probe",
+			"description": "Probes Postgres, Redis and Elasticsearch with a 2 second timeout each. Fails while the server is shutting down.",
+			"responses": withErrors(object{
+				"200": object{"description": "Every dependency is up", "content": jsonContent(ref("Readiness"))},
+				"503": object{"description": "A dependency is down or the server is shutting down", "content": jsonContent(ref("Readiness"))},
+			}),
+		},
+		"GET /v1/openapi.json": {
+			"summary": "Describe the API",
+			"responses": object{
+				"200": object{
+					"description": "This OpenAPI document",
+					"content":     jsonContent(object{"type": "object"}),
+				},
+			},
+		},
+		"POST /v1/search": {
+			"summary": "Search tasks",
+			"parameters": []object{
+				queryParameter("fields", stringSchema(), "Comma-separated list of the fields to return"),
+			},
+			"requestBody": requestBody(ref("SearchRequest")),
+			"responses": withErrors(object{
+				"200": object{
+					"description": "Matching tasks",
+					"content": jsonContent(object{
+						"type": "object",
+						"properties": object{
+							"tasks": arraySchema(ref("Task")),
+							"total": object{"type": "integer"},
+						},
+					}),
+				},
+			}, http.StatusBadRequest, http.StatusUnprocessableEntity),
+		},
+		"GET /v1/tasks": {
+			"summary":    "List tasks",
+			"parameters": listTasksParameters(),
+			"responses": withErrors(object{
+				"200": object{
+					"description": "A page of tasks",
+					"content": jsonContent(object{
+						"type": "object",
+						"properties": object{
+							"pagination": ref("Pagination"),
+							"tasks":      arraySchema(ref("Task")),
+						},
+					}),
+				},
+			}, http.StatusUnprocessableEntity),
+		},
+		"POST /v1/tasks": {
+			"summary": "Create a task",
+			"parameters": []object{
+				idempotencyKeyParameter(),
+			},
+			"requestBody": requestBody(ref("TaskInput")),
+			"responses": withErrors(object{
+				"201": object{
+					"description": "The created task",
+					"headers": object{
+						"Location": object{"schema": stringSchema()},
+					},
+					"content": jsonContent(taskEnvelope()),
+				},
+			}, http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity),
+		},
+		"POST /v1/tasks/batch": {
+			"summary": "Apply several task operations in one transaction",
+			"parameters": []object{
+				idempotencyKeyParameter(),
+			},
+			"requestBody": requestBody(ref("BatchRequest")),
+			"responses": withErrors(object{
+				"200": object{
+					"description": "Every operation was applied",
+					"content":     jsonContent(batchEnvelope()),
+				},
+				"422": object{
+					"description": "No operation was applied; the failing ones carry an error",
+					"content":     jsonContent(batchEnvelope()),
+				},
+			}, http.StatusBadRequest, http.StatusConflict),
+		},
+		"GET /v1/tasks/export": {
+			"summary": "Export the tasks matching the filters",
+			"parameters": append([]object{
+				queryParameter("format", object{"type": "string", "enum": []string{"csv", "markdown", "ndjson", "todotxt"}, "default": "csv"}, "Format of the export"),
+			}, filterParameters()...),
+			"responses": withErrors(object{
+				"200": object{
+					"description": "The tasks, one per row; CSV exports start with a header row naming the columns " + strings.Join(csvColumns, ", "),
+					"content": object{
+						"application/x-ndjson": object{"schema": ref("Task")},
+						"text/csv":             object{"schema": stringSchema()},
+						"text/markdown":        object{"schema": stringSchema()},
+						"text/plain":           object{"schema": stringSchema()},
+					},
+				},
+			}, http.StatusUnprocessableEntity),
+		},
+		"POST /v1/tasks/import": {
+			"summary":     "Import tasks from a CSV, NDJSON, todo.txt or Markdown checklist file",
+			"description": "Rows are read as exported by GET /v1/tasks/export; id, created_at and updated_at are ignored. todo.txt (text/plain) lines map (A), (B) and (C) to high, medium and low priorities, the creation date to started_at, due: to due_at and x to done. Markdown checklist items (text/markdown) are written - [ ] or - [x] followed by the description and due:, start: and priority: tags. In both, a description word written with a leading backslash, as in \\due:friday, is not read as a tag or marker. Valid rows are inserted together, in a single transaction, while invalid ones are reported. The status is 422 when no row could be imported.",
+			"requestBody": object{
+				"required": true,
+				"content": object{
+					"application/x-ndjson": object{"schema": ref("TaskInput")},
+					"text/csv":             object{"schema": stringSchema()},
+					"text/markdown":        object{"schema": stringSchema()},
+					"text/plain":           object{"schema": stringSchema()},
+				},
+			},
+			"responses": withErrors(object{
+				"200": object{
+					"description": "The number of imported tasks and the errors of the rows which were not imported",
+					"content": jsonContent(object{
+						"type": "object",
+						"properties": object{
+							"errors": arraySchema(object{
+								"type": "object",
+								"properties": object{
+									"errors": fieldErrors(),
+									"row":    object{"type": "integer"},
+								},
+							}),
+							"imported": object{"type": "integer"},
+						},
+					}),
+				},
+			}, http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity),
+		},
+		"GET /v1/tasks/{id}": {
+			"summary":    "Show a task",
+			"parameters": taskParameters,
+			"responses": withErrors(object{
+				"200": object{
+					"description": "The task",
+					"content":     jsonContent(taskEnvelope()),
+				},
+			}, http.StatusNotFound, http.StatusUnprocessableEntity),
+		},
+		"PATCH /v1/tasks/{id}": {
+			"summary":    "Update a task",
+			"parameters": taskParameters[:1],
+			"requestBody": object{
+				"required": true,
+				"content": object{
+					"application/json":             object{"schema": ref("TaskPatch")},
+					"application/merge-patch+json": object{"schema": ref("TaskPatch")},
+					"application/json-patch+json":  object{"schema": arraySchema(ref("JSONPatchOperation"))},
+				},
+			},
+			"responses": withErrors(object{
+				"200": object{
+					"description": "The updated task",
+					"content":     jsonContent(taskEnvelope()),
+				},
+			}, http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity),
+		},
+		"GET /v1/ws": {
+			"summary":     "Open a WebSocket to follow and edit tasks",
+			"description": "Clients send {\"type\": \"subscribe\"|\"unsubscribe\", \"ref\", \"task_ids\"} or {\"type\": \"operation\", \"ref\", \"op\", \"id\", \"task\"} messages, answered by ack or error messages with the same ref. Events on followed tasks arrive as {\"type\": \"event\", \"event\", \"event_id\", \"task\", \"task_id\"} messages.",
+			"responses": object{
+				"101": object{"description": "Switching to the WebSocket protocol"},
+				"400": object{"description": "The request is not a valid WebSocket handshake"},
+			},
+		},
+		"DELETE /v1/tasks/{id}": {
+			"summary":    "Delete a task",
+			"parameters": taskParameters[:1],
+			"responses": withErrors(object{
+				"200": object{
+					"description": "The task was deleted",
+					"content": jsonContent(object{
+						"type":       "object",
+						"properties": object{"message": stringSchema()},
+					}),
+				},
+			}, http.StatusNotFound),
+		},
+		"GET /v1/webhooks": {
+			"summary": "List the webhooks",
+			"responses": withErrors(object{
+				"200": object{
+					"description": "The webhooks",
+					"content": jsonContent(object{
+						"type":       "object",
+						"properties": object{"webhooks": arraySchema(ref("Webhook"))},
+					}),
+				},
+			}),
+		},
+		"POST /v1/webhooks": {
+			"summary":     "Register a webhook",
+			"description": "Task events are POSTed to the URL with the X-Tarsk-Event, X-Tarsk-Delivery and X-Tarsk-Signature headers. The signature is t=<unix time>,v1=<hex HMAC-SHA256 of \"<unix time>.<body>\" keyed by the secret>. Deliveries which are not answered with a 2xx status are retried with an exponential backoff.",
+			"requestBody": requestBody(ref("WebhookInput")),
+			"responses": withErrors(object{
+				"201": object{"description": "The webhook was registered", "content": jsonContent(webhookEnvelope())},
+			}, http.StatusBadRequest, http.StatusUnprocessableEntity),
+		},
+		"GET /v1/webhooks/{id}": {
+			"summary":    "Show a webhook",
+			"parameters": []object{pathParameter("id", "ID of the webhook")},
+			"responses": withErrors(object{
+				"200": object{"description": "The webhook", "content": jsonContent(webhookEnvelope())},
+			}, http.StatusNotFound),
+		},
+		"DELETE /v1/webhooks/{id}": {
+			"summary":    "Delete a webhook along with its deliveries",
+			"parameters": []object{pathParameter("id", "ID of the webhook")},
+			"responses": withErrors(object{
+				"200": object{
+					"description": "The webhook was deleted",
+					"content": jsonContent(object{
+						"type":       "object",
+						"properties": object{"message": stringSchema()},
+					}),
+				},
+			}, http.StatusNotFound),
+		},
+		"GET /v1/webhooks/{id}/deliveries": {
+			"summary": "List the latest deliveries of a webhook",
+			"parameters": []object{
+				pathParameter("id", "ID of the webhook"),
+				queryParameter("limit", object{"type": "integer", "default": 20, "maximum": 100}, "Number of deliveries to return"),
+			},
+			"responses": withErrors(object{
+				"200": object{
+					"description": "The deliveries, most recent first, with their attempts",
+					"content": jsonContent(object{
+						"type":       "object",
+						"properties": object{"deliveries": arraySchema(ref("WebhookDelivery"))},
+					}),
+				},
+			}, http.StatusNotFound, http.StatusUnprocessableEntity),
+		},
+		"POST /v1/webhooks/{id}/deliveries/{delivery_id}/redeliver": {
+			"summary": "Deliver the payload of a delivery again",
+			"parameters": []object{
+				pathParameter("id", "ID of the webhook"),
+				pathParameter("delivery_id", "ID of the delivery"),
+			},
+			"responses": withErrors(object{
+				"202": object{
+					"description": "A new delivery was scheduled",
+					"content": jsonContent(object{
+						"type":       "object",
+						"properties": object{"delivery": ref("WebhookDelivery")},
+					}),
+				},
+			}, http.StatusNotFound),
+		},
+	}
+}
+
+// openAPI builds the OpenAPI document from the route table. It fails if a
+// route has no description.
+func (app *application) openAPI() (object, error) {
+	operations := app.operations()
+	paths := make(object)
+
+	for _, route := range app.routeTable() {
+		path := openAPIPath(route.path)
+
+		operation, found := operations[route.method+" "+path]
+		if !found {
+			return nil, fmt.Errorf("route %s %s is not described in the OpenAPI document", route.method, route.path)
+		}
+
+		item, _ := paths[path].(object)
+		if item == nil {
+			item = make(object)
+			paths[path] = item
+		}
+		item[strings.ToLower(route.method)] = operation
+	}
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":       "Tarsk API",
+			"description": "Every response carries an X-Request-ID header, echoing the one of the request when it is at most 128 printable ASCII characters long. Events published while serving a request carry its ID. A W3C traceparent header makes the request part of the trace of the caller.",
+			"version":     version,
+		},
+		"paths": paths,
+		"components": object{
+			"schemas": schemas(),
+		},
+	}, nil
+}
+
+func (app *application) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	document, e := app.openAPI()
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+		return
+	}
+
+	e = app.writeJSON(w, http.StatusOK, envelope(document), nil)
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+	}
+}
+
+var routeParamPattern = regexp.MustCompile(`:([a-z_]+)`)
+
+// openAPIPath turns the httprouter parameters of a path into OpenAPI ones.
+func openAPIPath(path string) string {
+	return routeParamPattern.ReplaceAllString(path, "{$1}")
+}
+
+func listTasksParameters() []object {
+	var sortValues []string
+	for _, field := range taskSortSafelist {
+		sortValues = append(sortValues, field, "-"+field)
+	}
+
+	return append(filterParameters(),
+		queryParameter("sort", stringSchema(), "Comma-separated list of sort fields, each optionally prefixed with - for descending order: "+strings.Join(sortValues, ", ")),
+		queryParameter("page", object{"type": "integer", "minimum": 1, "maximum": 10_000_000, "default": 1}, "Page number"),
+		queryParameter("limit", object{"type": "integer", "minimum": 1, "maximum": 100, "default": 20}, "Number of tasks per page"),
+		queryParameter("cursor", stringSchema(), "The next_cursor of the previous page"),
+		queryParameter("count", object{"type": "boolean", "default": true}, "Whether to count the matching tasks"),
+		queryParameter("fields", stringSchema(), "Comma-separated list of the fields to return: "+strings.Join(data.TaskFields, ", ")),
+	)
+}
+
+// filterParameters describes the filters parsed by data.ParseFilters.
+func filterParameters() []object {
+	dateTime := object{"type": "string", "format": "date-time"}
+
+	return []object{
+		queryParameter("description", stringSchema(), "Full-text search on the description"),
+		queryParameter("done", object{"type": "boolean"}, "Only tasks which are (not) done"),
+		queryParameter("overdue", object{"type": "boolean"}, "Only tasks which are (not) overdue"),
+		queryParameter("due_after", dateTime, "Only tasks due after this date"),
+		queryParameter("due_before", dateTime, "Only tasks due before this date"),
+		queryParameter("started_after", dateTime, "Only tasks started after this date"),
+		queryParameter("started_before", dateTime, "Only tasks started before this date"),
+		queryParameter("priority", stringSchema(), "Comma-separated list of priorities"),
+		queryParameter("priority_gte", ref("Priority"), "Only tasks with at least this priority"),
+	}
+}
+
+func schemas() object {
+	dateTime := object{"type": "string", "format": "date-time"}
+	optionalDateTime := object{"type": "string", "format": "date-time", "nullable": true}
+	priorities := []interface{}{data.PriorityNone, data.PriorityLow, data.PriorityMedium, data.PriorityHigh}
+
+	taskInput := object{
+		"description": object{"type": "string", "maxLength": 512},
+		"due_at":      optionalDateTime,
+		"priority":    ref("Priority"),
+		"started_at":  optionalDateTime,
+	}
+
+	taskPatch := object{"done": object{"type": "boolean"}}
+	for key, value := range taskInput {
+		taskPatch[key] = value
+	}
+
+	return object{
+		"BatchRequest": object{
+			"type": "object",
+			"properties": object{
+				"filter": object{
+					"type":                 "object",
+					"description":          "Filters as accepted by GET /v1/tasks, matching at most 100 tasks",
+					"additionalProperties": stringSchema(),
+				},
+				"operations": arraySchema(object{
+					"type": "object",
+					"properties": object{
+						"id":   stringSchema(),
+						"op":   object{"type": "string", "enum": []string{"create", "update", "delete"}},
+						"task": ref("TaskPatch"),
+					},
+					"required": []string{"op"},
+				}),
+				"patch": ref("TaskPatch"),
+			},
+		},
+		"BatchResult": object{
+			"type": "object",
+			"properties": object{
+				"error":  object{"oneOf": []object{stringSchema(), fieldErrors()}},
+				"id":     stringSchema(),
+				"index":  object{"type": "integer"},
+				"op":     stringSchema(),
+				"status": object{"type": "integer"},
+				"task":   ref("Task"),
+			},
+		},
+		"Error": object{
+			"type": "object",
+			"properties": object{
+				"error": object{"oneOf": []object{stringSchema(), fieldErrors()}},
+			},
+		},
+		"JSONPatchOperation": object{
+			"type": "object",
+			"properties": object{
+				"from":  stringSchema(),
+				"op":    object{"type": "string", "enum": []string{"add", "remove", "replace", "move", "copy", "test"}},
+				"path":  stringSchema(),
+				"value": object{},
+			},
+			"required": []string{"op", "path"},
+		},
+		"LogLevel": object{
+			"type": "object",
+			"properties": object{
+				"level": object{"type": "string", "enum": []string{"DEBUG", "INFO", "WARN", "ERROR", "FATAL", "OFF"}, "description": "Accepted in any case"},
+			},
+			"required": []string{"level"},
+		},
+		"Pagination": object{
+			"type": "object",
+			"properties": object{
+				"current_page": object{"type": "integer"},
+				"first_page":   object{"type": "integer"},
+				"last_page":    object{"type": "integer"},
+				"limit":        object{"type": "integer"},
+				"next_cursor":  stringSchema(),
+				"total":        object{"type": "integer"},
+			},
+		},
+		"Priority": object{
+			"type": "string",
+			"enum": priorities,
+		},
+		"Problem": object{
+			"type": "object",
+			"properties": object{
+				"code":     stringSchema(),
+				"detail":   stringSchema(),
+				"errors":   fieldErrors(),
+				"instance": stringSchema(),
+				"status":   object{"type": "integer"},
+				"title":    stringSchema(),
+				"type":     stringSchema(),
+			},
+			"required": []string{"code", "status", "title", "type"},
+		},
+		"Readiness": object{
+			"type": "object",
+			"properties": object{
+				"dependencies": object{
+					"type": "object",
+					"additionalProperties": object{
+						"type": "object",
+						"properties": object{
+							"error":      stringSchema(),
+							"latency_ms": object{"type": "integer"},
+							"status":     object{"type": "string", "enum": []string{"up", "down"}},
+						},
+					},
+				},
+				"status": object{"type": "string", "enum": []string{"ready", "not_ready", "shutting_down"}},
+			},
+		},
+		"SearchRequest": object{
+			"type": "object",
+			"properties": object{
+				"description": stringSchema(),
+				"done":        object{"type": "boolean"},
+				"from":        object{"type": "integer"},
+				"priority":    ref("Priority"),
+				"size":        object{"type": "integer"},
+			},
+		},
+		"Task": object{
+			"type": "object",
+			"properties": object{
+				"created_at":  dateTime,
+				"description": stringSchema(),
+				"done":        object{"type": "boolean"},
+				"due_at":      optionalDateTime,
+				"id":          object{"type": "string", "format": "uuid"},
+				"priority":    ref("Priority"),
+				"started_at":  optionalDateTime,
+				"updated_at":  dateTime,
+			},
+		},
+		"TaskInput": object{
+			"type":       "object",
+			"properties": taskInput,
+			"required":   []string{"description"},
+		},
+		"TaskPatch": object{
+			"type":       "object",
+			"properties": taskPatch,
+		},
+		"Webhook": object{
+			"type": "object",
+			"properties": object{
+				"created_at": dateTime,
+				"events":     arraySchema(ref("WebhookEvent")),
+				"id":         object{"type": "string", "format": "uuid"},
+				"url":        stringSchema(),
+			},
+		},
+		"WebhookDelivery": object{
+			"type": "object",
+			"properties": object{
+				"attempt_count": object{"type": "integer"},
+				"attempts": arraySchema(object{
+					"type": "object",
+					"properties": object{
+						"attempted_at":    dateTime,
+						"duration_ms":     object{"type": "integer"},
+						"error":           stringSchema(),
+						"response_status": object{"type": "integer"},
+					},
+				}),
+				"created_at":      dateTime,
+				"event":           ref("WebhookEvent"),
+				"id":              object{"type": "string", "format": "uuid"},
+				"next_attempt_at": dateTime,
+				"payload":         object{"type": "object"},
+				"status":          object{"type": "string", "enum": []string{data.WebhookDeliveryPending, data.WebhookDeliverySucceeded, data.WebhookDeliveryFailed}},
+				"webhook_id":      object{"type": "string", "format": "uuid"},
+			},
+		},
+		"WebhookEvent": object{
+			"type": "string",
+			"enum": data.WebhookEvents,
+		},
+		"WebhookInput": object{
+			"type": "object",
+			"properties": object{
+				"events": object{
+					"type":        "array",
+					"items":       ref("WebhookEvent"),
+					"description": "Events to be notified of; all of them when empty",
+				},
+				"secret": object{"type": "string", "minLength": 16, "maxLength": 256},
+				"url":    object{"type": "string", "format": "uri"},
+			},
+			"required": []string{"secret", "url"},
+		},
+	}
+}
+
+func arraySchema(items object) object {
+	return object{"type": "array", "items": items}
+}
+
+func batchEnvelope() object {
+	return object{
+		"type":       "object",
+		"properties": object{"results": arraySchema(ref("BatchResult"))},
+	}
+}
+
+func fieldErrors() object {
+	return object{"type": "object", "additionalProperties": stringSchema()}
+}
+
+func idempotencyKeyParameter() object {
+	return object{
+		"name":        "Idempotency-Key",
+		"in":          "header",
+		"description": "Replays the stored response when the request is repeated with the same key",
+		"schema":      object{"type": "string", "maxLength": 255},
+	}
+}
+
+func jsonContent(schema object) object {
+	return object{"application/json": object{"schema": schema}}
+}
+
+func pathParameter(name, description string) object {
+	return object{
+		"name":        name,
+		"in":          "path",
+		"required":    true,
+		"description": description,
+		"schema":      stringSchema(),
+	}
+}
+
+func queryParameter(name string, schema object, description string) object {
+	return object{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"schema":      schema,
+	}
+}
+
+func ref(name string) object {
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+func requestBody(schema object) object {
+	return object{
+		"required": true,
+		"content":  jsonContent(schema),
+	}
+}
+
+func stringSchema() object {
+	return object{"type": "string"}
+}
+
+func taskEnvelope() object {
+	return object{
+		"type":       "object",
+		"properties": object{"task": ref("Task")},
+	}
+}
+
+func webhookEnvelope() object {
+	return object{
+		"type":       "object",
+		"properties": object{"webhook": ref("Webhook")},
+	}
+}
+
+// withErrors adds the given error statuses, as well as the ones any route may
+// answer with, to the responses of an operation.
+func withErrors(responses object, statuses ...int) object {
+	statuses = append(statuses, http.StatusTooManyRequests, http.StatusInternalServerError)
+
+	for _, status := range statuses {
+		responses[fmt.Sprint(status)] = object{
+			"description": http.StatusText(status),
+			"content": object{
+				"application/json":         object{"schema": ref("Error")},
+				"application/problem+json": object{"schema": ref("Problem")},
+			},
+		}
+	}
+
+	return responses
+}
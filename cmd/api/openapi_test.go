@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/thomascastle/tarsk/internal/metrics"
+	"github.com/thomascastle/tarsk/internal/structuredlog"
+)
+
+// TestOpenAPIDescribesRoutes fails when a route is registered without being
+// described in the OpenAPI document, or an operation is described without a
+// route serving it.
+func TestOpenAPIDescribesRoutes(t *testing.T) {
+	app := &application{}
+
+	operations := app.operations()
+
+	routes := make(map[string]bool)
+	for _, route := range app.routeTable() {
+		key := route.method + " " + openAPIPath(route.path)
+		routes[key] = true
+
+		if _, found := operations[key]; !found {
+			t.Errorf("route %s %s is not described in the OpenAPI document", route.method, route.path)
+		}
+	}
+
+	for key := range operations {
+		if !routes[key] {
+			t.Errorf("operation %s is described but no route serves it", key)
+		}
+	}
+
+	if _, e := app.openAPI(); e != nil {
+		t.Errorf("openAPI() = %v", e)
+	}
+}
+
+// TestRoutesRegister fails when two routes conflict, which httprouter reports
+// by panicking.
+func TestRoutesRegister(t *testing.T) {
+	app := &application{}
+	app.config.debug.enabled = true
+
+	app.routes()
+}
+
+// TestRoutesServeTaskExport fails when GET /v1/tasks/export is served as the
+// task with the id export rather than as the export.
+func TestRoutesServeTaskExport(t *testing.T) {
+	app := &application{
+		logger:  structuredlog.New(io.Discard, structuredlog.LevelInfo),
+		metrics: newAPIMetrics(metrics.NewRegistry(), nil),
+	}
+
+	w := httptest.NewRecorder()
+	app.routes().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/tasks/export?format=xlsx", nil))
+
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "format") {
+		t.Errorf("GET /v1/tasks/export?format=xlsx = %d %s, want 422 about the format", w.Code, w.Body)
+	}
+}
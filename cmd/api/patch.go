@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/thomascastle/tarsk/internal/data"
+	"github.com/thomascastle/tarsk/internal/jsonpatch"
+)
+
+// readMergePatch applies the RFC 7396 merge patch in the request body to the
+// task. A null member clears the corresponding field.
+func (app *application) readMergePatch(w http.ResponseWriter, r *http.Request, task *data.Task) error {
+	var patch map[string]interface{}
+
+	e := app.readJSON(w, r, &patch)
+	if e != nil {
+		return e
+	}
+
+	return patchTask(task, func(doc interface{}) (interface{}, error) {
+		return jsonpatch.Merge(doc, patch), nil
+	})
+}
+
+// readJSONPatch applies the RFC 6902 operations in the request body to the
+// task. A failing test operation leaves the task untouched and is reported with
+// jsonpatch.ErrorTestFailed.
+func (app *application) readJSONPatch(w http.ResponseWriter, r *http.Request, task *data.Task) error {
+	var operations []jsonpatch.Operation
+
+	e := app.readJSON(w, r, &operations)
+	if e != nil {
+		return e
+	}
+
+	return patchTask(task, func(doc interface{}) (interface{}, error) {
+		return jsonpatch.Apply(doc, operations)
+	})
+}
+
+// patchTask runs fn over the JSON representation of the task and reads the
+// patched document back into the task.
+func patchTask(task *data.Task, fn func(doc interface{}) (interface{}, error)) error {
+	original, e := taskDocument(task)
+	if e != nil {
+		return e
+	}
+
+	doc, e := taskDocument(task)
+	if e != nil {
+		return e
+	}
+
+	patched, e := fn(doc)
+	if e != nil {
+		return e
+	}
+
+	object, ok := patched.(map[string]interface{})
+	if !ok {
+		return errors.New("patch must result in a JSON object")
+	}
+
+	for _, field := range []string{"created_at", "id", "updated_at"} {
+		if !reflect.DeepEqual(object[field], original[field]) {
+			return fmt.Errorf("patch must not modify %q", field)
+		}
+	}
+
+	data_JSON, e := json.Marshal(object)
+	if e != nil {
+		return e
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data_JSON))
+	decoder.DisallowUnknownFields()
+
+	var result data.Task
+	e = decoder.Decode(&result)
+	if e != nil {
+		var unmarshalTypeError *json.UnmarshalTypeError
+
+		switch {
+		case errors.As(e, &unmarshalTypeError):
+			return fmt.Errorf("patch sets an incorrect JSON type for field %q", unmarshalTypeError.Field)
+		case strings.HasPrefix(e.Error(), "json: unknown field "):
+			return fmt.Errorf("patch adds unknown key %s", strings.TrimPrefix(e.Error(), "json: unknown field "))
+		default:
+			return fmt.Errorf("patch results in an invalid task: %w", e)
+		}
+	}
+
+	*task = result
+
+	return nil
+}
+
+func taskDocument(task *data.Task) (map[string]interface{}, error) {
+	data_JSON, e := json.Marshal(task)
+	if e != nil {
+		return nil, e
+	}
+
+	var doc map[string]interface{}
+	e = json.Unmarshal(data_JSON, &doc)
+
+	return doc, e
+}
@@ -4,17 +4,101 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/thomascastle/tarsk/internal/validator"
 )
 
+// operationalPaths are the paths of the routes serving the infrastructure
+// rather than clients.
+var operationalPaths = []string{"/livez", "/metrics", "/readyz"}
+
+// debugPaths are the paths of the routes which expose the internals of the
+// server, only registered with -debug-enabled.
+var debugPaths = []string{"/v1/debug/db", "/v1/debug/log-level"}
+
+type route struct {
+	handler http.HandlerFunc
+	method  string
+	path    string
+}
+
+func (app *application) routeTable() []route {
+	return []route{
+		{app.calendarHandler, http.MethodGet, "/v1/calendar.ics"},
+		{app.dbStatsHandler, http.MethodGet, "/v1/debug/db"},
+		{app.showLogLevelHandler, http.MethodGet, "/v1/debug/log-level"},
+		{app.updateLogLevelHandler, http.MethodPut, "/v1/debug/log-level"},
+		{app.eventsHandler, http.MethodGet, "/v1/events"},
+		{app.healthcheckHandler, http.MethodGet, "/v1/healthcheck"},
+		{app.openAPIHandler, http.MethodGet, "/v1/openapi.json"},
+		{app.searchHandler, http.MethodPost, "/v1/search"},
+		{app.listTasksHandler, http.MethodGet, "/v1/tasks"},
+		{app.idempotent(app.createTaskHandler), http.MethodPost, "/v1/tasks"},
+		{app.idempotent(app.batchTasksHandler), http.MethodPost, "/v1/tasks/batch"},
+		{app.exportTasksHandler, http.MethodGet, "/v1/tasks/export"},
+		{app.importTasksHandler, http.MethodPost, "/v1/tasks/import"},
+		{app.showTaskHandler, http.MethodGet, "/v1/tasks/:id"},
+		{app.updateTaskHandler, http.MethodPatch, "/v1/tasks/:id"},
+		{app.deleteTaskHandler, http.MethodDelete, "/v1/tasks/:id"},
+		{app.listWebhooksHandler, http.MethodGet, "/v1/webhooks"},
+		{app.createWebhookHandler, http.MethodPost, "/v1/webhooks"},
+		{app.showWebhookHandler, http.MethodGet, "/v1/webhooks/:id"},
+		{app.deleteWebhookHandler, http.MethodDelete, "/v1/webhooks/:id"},
+		{app.listWebhookDeliveriesHandler, http.MethodGet, "/v1/webhooks/:id/deliveries"},
+		{app.redeliverWebhookHandler, http.MethodPost, "/v1/webhooks/:id/deliveries/:delivery_id/redeliver"},
+		{app.websocketHandler, http.MethodGet, "/v1/ws"},
+		{app.livenessHandler, http.MethodGet, "/livez"},
+		{app.metricsHandler, http.MethodGet, "/metrics"},
+		{app.readinessHandler, http.MethodGet, "/readyz"},
+	}
+}
+
 func (app *application) routes() http.Handler {
 	router := httprouter.New()
 
-	router.HandlerFunc(http.MethodPost, "/v1/search", app.searchHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/tasks", app.listTasksHandler)
-	router.HandlerFunc(http.MethodPost, "/v1/tasks", app.createTaskHandler)
-	router.HandlerFunc(http.MethodGet, "/v1/tasks/:id", app.showTaskHandler)
-	router.HandlerFunc(http.MethodPatch, "/v1/tasks/:id", app.updateTaskHandler)
-	router.HandlerFunc(http.MethodDelete, "/v1/tasks/:id", app.deleteTaskHandler)
+	var export http.HandlerFunc
+
+	for _, route := range app.routeTable() {
+		if !app.config.debug.enabled && validator.In(route.path, debugPaths...) {
+			continue
+		}
+
+		// Panics are recovered within instrument, so that they are counted
+		// and traced as server errors.
+		handler := app.instrument(route.method, route.path, app.recoverPanic(route.handler))
+
+		// httprouter cannot register a static segment where another route
+		// has a parameter, so the route of a task serves the export too,
+		// which is still instrumented as a route of its own.
+		if route.method == http.MethodGet {
+			switch route.path {
+			case "/v1/tasks/export":
+				export = handler
+				continue
+			case "/v1/tasks/:id":
+				show := handler
+				handler = func(w http.ResponseWriter, r *http.Request) {
+					if routeParam(r, "id") == "export" {
+						export(w, r)
+						return
+					}
+					show(w, r)
+				}
+			}
+		}
+
+		router.HandlerFunc(route.method, route.path, handler)
+	}
+
+	// Probes and scrapes are not rate limited, so that a busy client cannot
+	// get the instance restarted or its metrics lost.
+	limited := app.rate(router)
+
+	return app.logRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if validator.In(r.URL.Path, operationalPaths...) {
+			router.ServeHTTP(w, r)
+			return
+		}
 
-	return app.rate(router)
+		limited.ServeHTTP(w, r)
+	}))
 }
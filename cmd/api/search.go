@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/thomascastle/tarsk/internal/data"
+	"github.com/thomascastle/tarsk/internal/validator"
 )
 
 func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
@@ -21,6 +22,13 @@ func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	v := validator.New()
+	fieldset := app.readFieldset(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	results, e := app.search.Query(
 		r.Context(),
 		data.SearchParams{
@@ -36,10 +44,15 @@ func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tasks := make([]interface{}, len(results.Tasks))
+	for i := range results.Tasks {
+		tasks[i] = fieldset.Project(&results.Tasks[i])
+	}
+
 	e = app.writeJSON(
 		w,
 		http.StatusOK,
-		envelope{"tasks": results.Tasks, "total": results.Total},
+		envelope{"tasks": tasks, "total": results.Total},
 		nil,
 	)
 	if e != nil {
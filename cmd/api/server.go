@@ -20,6 +20,27 @@ func (app *application) serve() error {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	// Long-lived responses such as event streams watch app.shutdown to end
+	// themselves, since Shutdown does not interrupt active connections.
+	server.RegisterOnShutdown(func() {
+		close(app.shutdown)
+	})
+
+	hubCtx, stopHub := context.WithCancel(context.Background())
+	defer stopHub()
+
+	go app.runEventHub(hubCtx)
+
+	go func() {
+		for {
+			time.Sleep(time.Hour)
+
+			if e := app.repositories.Idempotency.DeleteExpired(); e != nil {
+				app.logger.Error(e, nil)
+			}
+		}
+	}()
+
 	errorShuttingDown := make(chan error)
 
 	go func() {
@@ -27,7 +48,12 @@ func (app *application) serve() error {
 		signal.Notify(signalQuitting, syscall.SIGINT, syscall.SIGTERM)
 		s := <-signalQuitting // blocks until a signal is received
 
-		app.logger.Info("server gracefully shutting down...", map[string]string{"signal": s.String()})
+		app.logger.Info("server gracefully shutting down...", map[string]any{"signal": s.String()})
+
+		// Fail readiness first and keep serving for a while, so that load
+		// balancers stop routing requests before connections are refused.
+		app.shuttingDown.Store(true)
+		time.Sleep(app.config.shutdown.delay)
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -40,7 +66,7 @@ func (app *application) serve() error {
 		errorShuttingDown <- nil
 	}()
 
-	app.logger.Info("server started", map[string]string{"addr": server.Addr, "env": app.config.env})
+	app.logger.Info("server started", map[string]any{"addr": server.Addr, "env": app.config.env})
 
 	e := server.ListenAndServe()
 	if !errors.Is(e, http.ErrServerClosed) {
@@ -52,7 +78,7 @@ func (app *application) serve() error {
 		return e
 	}
 
-	app.logger.Info("server stopped", map[string]string{"addr": server.Addr})
+	app.logger.Info("server stopped", map[string]any{"addr": server.Addr})
 
 	return nil
 }
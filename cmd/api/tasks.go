@@ -1,19 +1,22 @@
 package main
 
 import (
-	"context"
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/thomascastle/tarsk/internal/data"
+	"github.com/thomascastle/tarsk/internal/jsonpatch"
 	"github.com/thomascastle/tarsk/internal/validator"
 )
 
+var taskSortSafelist = []string{"created_at", "description", "due_at", "priority", "started_at", "updated_at"}
+
 func (app *application) listTasksHandler(w http.ResponseWriter, r *http.Request) {
 	values := r.URL.Query()
-	search := app.readString(values, "description", "")
 
 	filters := data.ParseFilters(values)
 	v := validator.New()
@@ -24,7 +27,7 @@ func (app *application) listTasksHandler(w http.ResponseWriter, r *http.Request)
 
 	sort := data.Sort{}
 	sort.Sort = app.readString(values, "sort", "due_at")
-	sort.SortSafelist = []string{"due_at", "priority", "-due_at", "-priority"}
+	sort.SortSafelist = taskSortSafelist
 	if sort.Validate(v); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
@@ -43,18 +46,40 @@ func (app *application) listTasksHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	paginator.Limit = value
+	count, e := app.readBool(values, "count", true)
+	if e != nil {
+		app.failedValidationResponse(w, r, map[string]string{"count": "must be a boolean value"})
+		return
+	}
+	paginator.Count = count
+	if cursor := app.readString(values, "cursor", ""); cursor != "" {
+		paginator.Cursor, e = data.DecodeCursor(cursor)
+		if e != nil {
+			app.failedValidationResponse(w, r, map[string]string{"cursor": "invalid value"})
+			return
+		}
+		v.Check(paginator.Cursor.Sort == sort.Sort, "cursor", "does not match the sort value")
+	}
 	if paginator.Validate(v); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	tasks, pagination, e := app.taskIndexRepository.Select(search, &filters, sort, paginator)
+	fieldset := app.readFieldset(values, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	tasks, pagination, e := app.taskIndexRepository.WithContext(r.Context()).Select(&filters, sort, paginator, fieldset)
 	if e != nil {
 		app.serverErrorResponse(w, r, e)
 		return
 	}
 
-	e = app.writeJSON(w, http.StatusOK, envelope{"tasks": tasks, "pagination": pagination}, nil)
+	// No Last-Modified is sent for lists as it cannot account for deleted
+	// tasks; the ETag, which is derived from the body, does.
+	e = app.writeConditionalJSON(w, r, http.StatusOK, envelope{"tasks": fieldset.ProjectAll(tasks), "pagination": pagination}, time.Time{})
 	if e != nil {
 		app.serverErrorResponse(w, r, e)
 	}
@@ -87,13 +112,13 @@ func (app *application) createTaskHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	e = app.repositories.Tasks.Insert(task)
+	e = app.repositories.Tasks.WithContext(r.Context()).Insert(task)
 	if e != nil {
 		app.serverErrorResponse(w, r, e)
 		return
 	}
 
-	e = app.messageBrokerage.Created(context.Background(), task)
+	e = app.messageBrokerage.Created(eventContext(r), task)
 	if e != nil {
 		app.logger.Error(e, nil)
 	}
@@ -110,7 +135,14 @@ func (app *application) createTaskHandler(w http.ResponseWriter, r *http.Request
 func (app *application) showTaskHandler(w http.ResponseWriter, r *http.Request) {
 	id := routeParam(r, "id")
 
-	task, e := app.repositories.Tasks.SelectOne(id)
+	v := validator.New()
+	fieldset := app.readFieldset(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	task, e := app.repositories.Tasks.WithContext(r.Context()).SelectOne(id)
 	if e != nil {
 		switch {
 		case errors.Is(e, data.ErrorRecordNotFound):
@@ -121,7 +153,7 @@ func (app *application) showTaskHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	e = app.writeJSON(w, http.StatusOK, envelope{"task": task}, nil)
+	e = app.writeConditionalJSON(w, r, http.StatusOK, envelope{"task": fieldset.Project(task)}, task.UpdatedAt)
 	if e != nil {
 		app.serverErrorResponse(w, r, e)
 	}
@@ -130,7 +162,7 @@ func (app *application) showTaskHandler(w http.ResponseWriter, r *http.Request)
 func (app *application) updateTaskHandler(w http.ResponseWriter, r *http.Request) {
 	id := routeParam(r, "id")
 
-	task, e := app.repositories.Tasks.SelectOne(id)
+	task, e := app.repositories.Tasks.WithContext(r.Context()).SelectOne(id)
 	if e != nil {
 		switch {
 		case errors.Is(e, data.ErrorRecordNotFound):
@@ -141,43 +173,38 @@ func (app *application) updateTaskHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	var input struct {
-		Description *string        `json:"description"`
-		Done        *bool          `json:"done"`
-		DueAt       time.Time      `json:"due_at"`
-		Priority    *data.Priority `json:"priority"`
-		StartedAt   time.Time      `json:"started_at"`
+	// The Content-Type selects how the body describes the changes: a plain
+	// JSON object of the fields to set, an RFC 7396 merge patch or an
+	// RFC 6902 JSON patch.
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "", "application/json":
+		e = app.readTaskUpdate(w, r, task)
+	case "application/merge-patch+json":
+		e = app.readMergePatch(w, r, task)
+	case "application/json-patch+json":
+		e = app.readJSONPatch(w, r, task)
+	default:
+		app.unsupportedMediaTypeResponse(w, r)
+		return
 	}
-
-	e = app.readJSON(w, r, &input)
 	if e != nil {
-		app.badRequestResponse(w, r, e)
+		switch {
+		case errors.Is(e, jsonpatch.ErrorTestFailed):
+			app.editConflictResponse(w, r, e)
+		default:
+			app.badRequestResponse(w, r, e)
+		}
 		return
 	}
 
-	if input.Description != nil {
-		task.Description = *input.Description
-	}
-	if input.Done != nil {
-		task.Done = *input.Done
-	}
-	if !input.DueAt.IsZero() {
-		task.DueAt = input.DueAt
-	}
-	if input.Priority != nil {
-		task.Priority = *input.Priority
-	}
-	if !input.StartedAt.IsZero() {
-		task.StartedAt = input.StartedAt
-	}
-
 	v := validator.New()
 	if data.ValidateTask(v, task); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	e = app.repositories.Tasks.Update(task)
+	e = app.repositories.Tasks.WithContext(r.Context()).Update(task)
 	if e != nil {
 		switch {
 		case errors.Is(e, data.ErrorEditConflict):
@@ -188,7 +215,7 @@ func (app *application) updateTaskHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	e = app.messageBrokerage.Updated(context.Background(), task)
+	e = app.messageBrokerage.Updated(eventContext(r), task)
 	if e != nil {
 		app.logger.Error(e, nil)
 	}
@@ -199,10 +226,43 @@ func (app *application) updateTaskHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
+func (app *application) readTaskUpdate(w http.ResponseWriter, r *http.Request, task *data.Task) error {
+	var input struct {
+		Description *string        `json:"description"`
+		Done        *bool          `json:"done"`
+		DueAt       time.Time      `json:"due_at"`
+		Priority    *data.Priority `json:"priority"`
+		StartedAt   time.Time      `json:"started_at"`
+	}
+
+	e := app.readJSON(w, r, &input)
+	if e != nil {
+		return e
+	}
+
+	if input.Description != nil {
+		task.Description = *input.Description
+	}
+	if input.Done != nil {
+		task.Done = *input.Done
+	}
+	if !input.DueAt.IsZero() {
+		task.DueAt = input.DueAt
+	}
+	if input.Priority != nil {
+		task.Priority = *input.Priority
+	}
+	if !input.StartedAt.IsZero() {
+		task.StartedAt = input.StartedAt
+	}
+
+	return nil
+}
+
 func (app *application) deleteTaskHandler(w http.ResponseWriter, r *http.Request) {
 	id := routeParam(r, "id")
 
-	e := app.repositories.Tasks.Delete(id)
+	e := app.repositories.Tasks.WithContext(r.Context()).Delete(id)
 	if e != nil {
 		switch {
 		case errors.Is(e, data.ErrorRecordNotFound):
@@ -213,7 +273,7 @@ func (app *application) deleteTaskHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	e = app.messageBrokerage.Deleted(context.Background(), id)
+	e = app.messageBrokerage.Deleted(eventContext(r), id)
 	if e != nil {
 		app.logger.Error(e, nil)
 	}
@@ -223,3 +283,14 @@ func (app *application) deleteTaskHandler(w http.ResponseWriter, r *http.Request
 		app.serverErrorResponse(w, r, e)
 	}
 }
+
+// readFieldset reads the fields query parameter shared by the handlers
+// responding with tasks.
+func (app *application) readFieldset(values url.Values, v *validator.Validator) data.Fieldset {
+	fieldset := data.Fieldset{}
+	fieldset.Fields = app.readString(values, "fields", "")
+	fieldset.FieldsSafelist = data.TaskFields
+	fieldset.Validate(v)
+
+	return fieldset
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thomascastle/tarsk/internal/data"
+)
+
+func TestListTasksRejectsCursor(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		sort   string
+		cursor string
+	}{
+		{"malformed", "due_at", "not a cursor!"},
+		{"tampered", "due_at", (&data.Cursor{ID: "42", Sort: "due_at", Values: []interface{}{"tomorrow"}}).Encode()},
+		{"other sort", "due_at", (&data.Cursor{ID: "42", Sort: "-due_at", Values: []interface{}{day}}).Encode()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := &application{}
+
+			query := url.Values{"cursor": {test.cursor}, "sort": {test.sort}}
+			w := httptest.NewRecorder()
+			app.listTasksHandler(w, httptest.NewRequest(http.MethodGet, "/v1/tasks?"+query.Encode(), nil))
+
+			if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "cursor") {
+				t.Errorf("status = %d, body = %s, want 422 about the cursor", w.Code, w.Body)
+			}
+		})
+	}
+}
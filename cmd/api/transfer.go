@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thomascastle/tarsk/internal/data"
+	"github.com/thomascastle/tarsk/internal/formats"
+	"github.com/thomascastle/tarsk/internal/validator"
+)
+
+const (
+	importBatchSize = 100
+	maxImportBytes  = 33_554_432
+)
+
+// csvColumns are the columns of exported CSV files, in order. Imports accept
+// them in any order; id, created_at and updated_at are ignored.
+var csvColumns = []string{"id", "description", "done", "due_at", "priority", "started_at", "created_at", "updated_at"}
+
+// importError reports why a row was not imported. Rows are numbered from 1 in
+// the order of the file, the header of a CSV file being row 1.
+type importError struct {
+	Errors map[string]string `json:"errors"`
+	Row    int               `json:"row"`
+}
+
+// exportTasksHandler streams the tasks matching the filters of GET /v1/tasks
+// as CSV, newline-delimited JSON, todo.txt or a Markdown checklist, row by
+// row.
+func (app *application) exportTasksHandler(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+
+	filters := data.ParseFilters(values)
+	v := validator.New()
+	filters.Validate(v)
+
+	format := app.readString(values, "format", "csv")
+	v.Check(validator.In(format, "csv", "markdown", "ndjson", "todotxt"), "format", "must be one of csv, markdown, ndjson or todotxt")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The export outlives the server's WriteTimeout.
+	rc := http.NewResponseController(w)
+	if e := rc.SetWriteDeadline(time.Time{}); e != nil {
+		app.serverErrorResponse(w, r, e)
+		return
+	}
+
+	var write func(task *data.Task) error
+	var flush func() error
+
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		write = func(task *data.Task) error {
+			return cw.Write(csvRecord(task))
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+
+		w.Header().Set("Content-Disposition", `attachment; filename="tasks.csv"`)
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+
+		if e := cw.Write(csvColumns); e != nil {
+			app.logError(r, e)
+			return
+		}
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		write = func(task *data.Task) error {
+			return encoder.Encode(task)
+		}
+		flush = func() error {
+			return nil
+		}
+
+		w.Header().Set("Content-Disposition", `attachment; filename="tasks.ndjson"`)
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+	case "markdown", "todotxt":
+		line := formats.FormatTodoTxt
+		filename := "todo.txt"
+		contentType := "text/plain; charset=utf-8"
+		if format == "markdown" {
+			line = formats.FormatMarkdown
+			filename = "tasks.md"
+			contentType = "text/markdown; charset=utf-8"
+		}
+
+		write = func(task *data.Task) error {
+			_, e := io.WriteString(w, line(task)+"\n")
+			return e
+		}
+		flush = func() error {
+			return nil
+		}
+
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+	}
+
+	// Once the status is written, a failure can only cut the body short.
+	e := app.repositories.Tasks.WithContext(r.Context()).Each(&filters, write)
+	if e == nil {
+		e = flush()
+	}
+	if e != nil {
+		app.logError(r, e)
+	}
+}
+
+// importTasksHandler reads tasks from a CSV (text/csv), newline-delimited JSON
+// (application/x-ndjson), todo.txt (text/plain) or Markdown checklist
+// (text/markdown) body. Each row is validated on its own: valid
+// rows are inserted together while invalid ones are reported with their
+// errors.
+func (app *application) importTasksHandler(w http.ResponseWriter, r *http.Request) {
+	var read func(body io.Reader, fn func(row int, task *data.Task, fieldErrors map[string]string) error) error
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		read = readCSVTasks
+	case "application/x-ndjson", "application/ndjson":
+		read = readNDJSONTasks
+	case "text/markdown":
+		read = readLineTasks(formats.ParseMarkdown)
+	case "text/plain":
+		read = readLineTasks(formats.ParseTodoTxt)
+	default:
+		app.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	// Large files take longer to upload than the server's ReadTimeout.
+	rc := http.NewResponseController(w)
+	if e := rc.SetReadDeadline(time.Now().Add(2 * time.Minute)); e != nil {
+		app.serverErrorResponse(w, r, e)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	importErrors := []importError{}
+	var valid []*data.Task
+
+	e := read(r.Body, func(row int, task *data.Task, fieldErrors map[string]string) error {
+		if fieldErrors == nil {
+			v := validator.New()
+			if data.ValidateTask(v, task); !v.Valid() {
+				fieldErrors = v.Errors
+			}
+		}
+		if fieldErrors != nil {
+			importErrors = append(importErrors, importError{Errors: fieldErrors, Row: row})
+			return nil
+		}
+
+		valid = append(valid, task)
+
+		return nil
+	})
+	if e != nil {
+		var maxBytesError *http.MaxBytesError
+		var parseError *csv.ParseError
+
+		switch {
+		case errors.As(e, &maxBytesError):
+			app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxImportBytes))
+		case errors.As(e, &parseError):
+			app.badRequestResponse(w, r, fmt.Errorf("body contains badly-formed CSV (at line %d)", parseError.Line))
+		case errors.Is(e, errorInvalidColumns):
+			app.badRequestResponse(w, r, e)
+		default:
+			app.serverErrorResponse(w, r, e)
+		}
+		return
+	}
+
+	// The valid rows are inserted in a single transaction, so that a failure
+	// imports none of them, and the events are only published once they are.
+	var imported []*data.Task
+
+	e = app.repositories.Tasks.WithContext(r.Context()).Transaction(func(tasks data.TaskRepository) error {
+		for len(valid) > 0 {
+			batch := valid[:min(importBatchSize, len(valid))]
+			valid = valid[len(batch):]
+
+			inserted, e := tasks.InsertMany(batch)
+			if e != nil {
+				return e
+			}
+			imported = append(imported, inserted...)
+		}
+
+		return nil
+	})
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+		return
+	}
+
+	for _, task := range imported {
+		if e := app.messageBrokerage.Created(eventContext(r), task); e != nil {
+			app.logger.Error(e, nil)
+		}
+	}
+
+	status := http.StatusOK
+	if len(imported) == 0 && len(importErrors) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+
+	e = app.writeJSON(w, status, envelope{"errors": importErrors, "imported": len(imported)}, nil)
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+	}
+}
+
+var errorInvalidColumns = errors.New("the header row must only contain the columns " + strings.Join(csvColumns, ", "))
+
+// readCSVTasks calls fn with each record of a CSV file whose first row names
+// the columns.
+func readCSVTasks(body io.Reader, fn func(row int, task *data.Task, fieldErrors map[string]string) error) error {
+	reader := csv.NewReader(body)
+	reader.ReuseRecord = true
+
+	header, e := reader.Read()
+	if e != nil {
+		if errors.Is(e, io.EOF) {
+			return errorInvalidColumns
+		}
+		return e
+	}
+
+	columns := make([]string, len(header))
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		if !validator.In(column, csvColumns...) {
+			return errorInvalidColumns
+		}
+		columns[i] = column
+	}
+
+	for row := 2; ; row++ {
+		record, e := reader.Read()
+		if errors.Is(e, io.EOF) {
+			return nil
+		}
+		if errors.Is(e, csv.ErrFieldCount) {
+			if e := fn(row, nil, map[string]string{"row": "must have as many fields as the header"}); e != nil {
+				return e
+			}
+			continue
+		}
+		if e != nil {
+			return e
+		}
+
+		task, fieldErrors := parseCSVRecord(columns, record)
+		if e := fn(row, task, fieldErrors); e != nil {
+			return e
+		}
+	}
+}
+
+// readNDJSONTasks calls fn with each line of a newline-delimited JSON file.
+// Blank lines are skipped.
+func readNDJSONTasks(body io.Reader, fn func(row int, task *data.Task, fieldErrors map[string]string) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 4096), 1_048_576)
+
+	for row := 1; scanner.Scan(); row++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var input data.Task
+
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.DisallowUnknownFields()
+		if e := decoder.Decode(&input); e != nil {
+			if e := fn(row, nil, map[string]string{"row": "must be a well-formed JSON task"}); e != nil {
+				return e
+			}
+			continue
+		}
+
+		task := &data.Task{
+			Description: input.Description,
+			Done:        input.Done,
+			DueAt:       input.DueAt,
+			Priority:    prioritize(input.Priority),
+			StartedAt:   input.StartedAt,
+		}
+		if e := fn(row, task, nil); e != nil {
+			return e
+		}
+	}
+
+	return scanner.Err()
+}
+
+// readLineTasks returns a reader of a line based format, in which lines that
+// parse returns no task for are skipped.
+func readLineTasks(parse func(line string) (*data.Task, error)) func(body io.Reader, fn func(row int, task *data.Task, fieldErrors map[string]string) error) error {
+	return func(body io.Reader, fn func(row int, task *data.Task, fieldErrors map[string]string) error) error {
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 0, 4096), 1_048_576)
+
+		for row := 1; scanner.Scan(); row++ {
+			task, e := parse(scanner.Text())
+			if e != nil {
+				if e := fn(row, nil, map[string]string{"row": e.Error()}); e != nil {
+					return e
+				}
+				continue
+			}
+			if task == nil {
+				continue
+			}
+
+			if e := fn(row, task, nil); e != nil {
+				return e
+			}
+		}
+
+		return scanner.Err()
+	}
+}
+
+func parseCSVRecord(columns, record []string) (*data.Task, map[string]string) {
+	task := &data.Task{}
+	fieldErrors := make(map[string]string)
+
+	for i, value := range record {
+		value = strings.TrimSpace(value)
+
+		switch columns[i] {
+		case "description":
+			task.Description = value
+		case "done":
+			if value == "" {
+				continue
+			}
+			done, e := strconv.ParseBool(value)
+			if e != nil {
+				fieldErrors["done"] = "must be a boolean value"
+			}
+			task.Done = done
+		case "due_at":
+			t, e := parseCSVTime(value)
+			if e != nil {
+				fieldErrors["due_at"] = "must be an RFC 3339 date and time"
+			}
+			task.DueAt = t
+		case "priority":
+			task.Priority = data.Priority(value)
+		case "started_at":
+			t, e := parseCSVTime(value)
+			if e != nil {
+				fieldErrors["started_at"] = "must be an RFC 3339 date and time"
+			}
+			task.StartedAt = t
+		}
+	}
+
+	if len(fieldErrors) > 0 {
+		return nil, fieldErrors
+	}
+
+	task.Priority = prioritize(task.Priority)
+
+	return task, nil
+}
+
+// parseCSVTime parses an RFC 3339 time. An empty value is the zero time, which
+// leaves the date unset.
+func parseCSVTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+func csvRecord(task *data.Task) []string {
+	return []string{
+		task.ID,
+		task.Description,
+		strconv.FormatBool(task.Done),
+		csvTime(task.DueAt),
+		string(task.Priority),
+		csvTime(task.StartedAt),
+		task.CreatedAt.Format(time.RFC3339),
+		task.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// csvTime formats a date as parseCSVTime parses it, a date which is not set
+// as an empty field.
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
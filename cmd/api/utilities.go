@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,11 +11,27 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/thomascastle/tarsk/internal/data"
 )
 
+func (app *application) readBool(values url.Values, key string, defaultValue bool) (bool, error) {
+	value := values.Get(key)
+
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	b, e := strconv.ParseBool(value)
+	if e != nil {
+		return defaultValue, e
+	}
+
+	return b, nil
+}
+
 func (app *application) readInt(values url.Values, key string, defaultValue int) (int, error) {
 	value := values.Get(key)
 
@@ -104,6 +122,76 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 	return nil
 }
 
+// writeConditionalJSON writes data like writeJSON, tagged with an ETag derived
+// from the body and with lastModified unless it is zero. When the request's
+// If-None-Match or If-Modified-Since shows that the client already has this
+// representation, only 304 Not Modified is written.
+func (app *application) writeConditionalJSON(w http.ResponseWriter, r *http.Request, status int, data envelope, lastModified time.Time) error {
+	data_JSON, e := json.MarshalIndent(data, "", "\t")
+	if e != nil {
+		return e
+	}
+
+	data_JSON = append(data_JSON, '\n')
+
+	hash := sha256.Sum256(data_JSON)
+	etag := `"` + hex.EncodeToString(hash[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data_JSON)
+
+	return nil
+}
+
+// notModified evaluates If-None-Match and, in its absence, If-Modified-Since
+// as described in RFC 7232.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, value := range strings.Split(match, ",") {
+			value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+			if value == "*" || value == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if since := r.Header.Get("If-Modified-Since"); since != "" && !lastModified.IsZero() {
+		t, e := http.ParseTime(since)
+		if e == nil && !lastModified.Truncate(time.Second).After(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (app *application) writeProblem(w http.ResponseWriter, p problem) error {
+	data_JSON, e := json.MarshalIndent(p, "", "\t")
+	if e != nil {
+		return e
+	}
+
+	data_JSON = append(data_JSON, '\n')
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	w.Write(data_JSON)
+
+	return nil
+}
+
 func prioritize(priority data.Priority) data.Priority {
 	if priority == "" {
 		return data.PriorityNone
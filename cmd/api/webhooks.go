@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/thomascastle/tarsk/internal/data"
+	"github.com/thomascastle/tarsk/internal/validator"
+)
+
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Events []string `json:"events"`
+		Secret string   `json:"secret"`
+		URL    string   `json:"url"`
+	}
+
+	e := app.readJSON(w, r, &input)
+	if e != nil {
+		app.badRequestResponse(w, r, e)
+		return
+	}
+
+	webhook := &data.Webhook{
+		Events: input.Events,
+		Secret: input.Secret,
+		URL:    input.URL,
+	}
+	if webhook.Events == nil {
+		webhook.Events = []string{}
+	}
+
+	v := validator.New()
+	if data.ValidateWebhook(v, webhook); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	e = app.repositories.Webhooks.Insert(webhook)
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/webhooks/%s", webhook.ID))
+
+	e = app.writeJSON(w, http.StatusCreated, envelope{"webhook": webhook}, headers)
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+	}
+}
+
+func (app *application) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	webhooks, e := app.repositories.Webhooks.Select()
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+		return
+	}
+
+	e = app.writeJSON(w, http.StatusOK, envelope{"webhooks": webhooks}, nil)
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+	}
+}
+
+func (app *application) showWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, e := app.repositories.Webhooks.SelectOne(routeParam(r, "id"))
+	if e != nil {
+		switch {
+		case errors.Is(e, data.ErrorRecordNotFound):
+			app.resourceNotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, e)
+		}
+		return
+	}
+
+	e = app.writeJSON(w, http.StatusOK, envelope{"webhook": webhook}, nil)
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+	}
+}
+
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	e := app.repositories.Webhooks.Delete(routeParam(r, "id"))
+	if e != nil {
+		switch {
+		case errors.Is(e, data.ErrorRecordNotFound):
+			app.resourceNotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, e)
+		}
+		return
+	}
+
+	e = app.writeJSON(w, http.StatusOK, envelope{"message": "The webhook has been deleted successfully."}, nil)
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+	}
+}
+
+// listWebhookDeliveriesHandler responds with the latest deliveries of a
+// webhook and the outcome of each of their attempts.
+func (app *application) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, e := app.repositories.Webhooks.SelectOne(routeParam(r, "id"))
+	if e != nil {
+		switch {
+		case errors.Is(e, data.ErrorRecordNotFound):
+			app.resourceNotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, e)
+		}
+		return
+	}
+
+	limit, e := app.readInt(r.URL.Query(), "limit", 20)
+	if e != nil {
+		app.failedValidationResponse(w, r, map[string]string{"limit": "must be an integer value"})
+		return
+	}
+
+	v := validator.New()
+	v.Check(limit > 0, "limit", "must be greater than zero")
+	v.Check(limit <= 100, "limit", "must be a maximum of 100")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	deliveries, e := app.repositories.WebhookDeliveries.SelectForWebhook(webhook.ID, limit)
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+		return
+	}
+
+	e = app.writeJSON(w, http.StatusOK, envelope{"deliveries": deliveries}, nil)
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+	}
+}
+
+// redeliverWebhookHandler schedules a new delivery of the payload of an
+// earlier one, which the dispatcher attempts on its next run.
+func (app *application) redeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	delivery, e := app.repositories.WebhookDeliveries.SelectOne(routeParam(r, "id"), routeParam(r, "delivery_id"))
+	if e != nil {
+		switch {
+		case errors.Is(e, data.ErrorRecordNotFound):
+			app.resourceNotFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, e)
+		}
+		return
+	}
+
+	redelivery := &data.WebhookDelivery{
+		Event:     delivery.Event,
+		Payload:   delivery.Payload,
+		WebhookID: delivery.WebhookID,
+	}
+
+	e = app.repositories.WebhookDeliveries.Insert(redelivery)
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+		return
+	}
+
+	e = app.writeJSON(w, http.StatusAccepted, envelope{"delivery": redelivery}, nil)
+	if e != nil {
+		app.serverErrorResponse(w, r, e)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/thomascastle/tarsk/internal/data"
+	"github.com/thomascastle/tarsk/internal/messaging"
+	"github.com/thomascastle/tarsk/internal/validator"
+)
+
+const (
+	websocketMaxMessageSize = 65_536
+	websocketPingInterval   = 30 * time.Second
+	websocketPongTimeout    = 60 * time.Second
+	websocketWriteTimeout   = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// websocketRequest is a message sent by a client. Subscribe and unsubscribe
+// take the IDs of the tasks to (un)follow; no IDs stand for every task. An
+// operation is applied like an item of a batch request.
+type websocketRequest struct {
+	Ref     string   `json:"ref"`
+	TaskIDs []string `json:"task_ids"`
+	Type    string   `json:"type"`
+	batchOperation
+}
+
+// websocketResponse is a message sent to a client: the acknowledgement or
+// error answering a request with the same ref, or a task event.
+type websocketResponse struct {
+	Error   interface{}  `json:"error,omitempty"`
+	Event   string       `json:"event,omitempty"`
+	EventID string       `json:"event_id,omitempty"`
+	Ref     string       `json:"ref,omitempty"`
+	Result  *batchResult `json:"result,omitempty"`
+	Task    *data.Task   `json:"task,omitempty"`
+	TaskID  string       `json:"task_id,omitempty"`
+	Type    string       `json:"type"`
+}
+
+// subscription records the tasks a connection follows.
+type subscription struct {
+	all     bool
+	taskIDs map[string]bool
+}
+
+func (s *subscription) update(subscribe bool, taskIDs []string) {
+	if len(taskIDs) == 0 {
+		s.all = subscribe
+		if !subscribe {
+			s.taskIDs = make(map[string]bool)
+		}
+		return
+	}
+
+	for _, id := range taskIDs {
+		if subscribe {
+			s.taskIDs[id] = true
+		} else {
+			delete(s.taskIDs, id)
+		}
+	}
+}
+
+// follows reports whether the event concerns a followed task. New tasks can
+// only be followed by subscribing to every task.
+func (s *subscription) follows(taskID string) bool {
+	return s.all || s.taskIDs[taskID]
+}
+
+func (app *application) websocketHandler(w http.ResponseWriter, r *http.Request) {
+	conn, e := upgrader.Upgrade(w, r, nil)
+	if e != nil {
+		// The upgrader has already written an error response.
+		return
+	}
+	defer conn.Close()
+
+	conn.SetReadLimit(websocketMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(websocketPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(websocketPongTimeout))
+	})
+
+	events := app.hub.subscribe()
+	defer app.hub.unsubscribe(events)
+
+	requests := make(chan websocketRequest)
+	closed := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(closed)
+
+		for {
+			var request websocketRequest
+			if e := conn.ReadJSON(&request); e != nil {
+				var syntaxError *json.SyntaxError
+				var unmarshalTypeError *json.UnmarshalTypeError
+				if !errors.As(e, &syntaxError) && !errors.As(e, &unmarshalTypeError) {
+					return
+				}
+				request = websocketRequest{Type: "invalid"}
+			}
+
+			select {
+			case requests <- request:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// All writes happen on this goroutine, as a connection supports only one
+	// concurrent writer.
+	send := func(response websocketResponse) bool {
+		conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+		return conn.WriteJSON(response) == nil
+	}
+
+	ping := time.NewTicker(websocketPingInterval)
+	defer ping.Stop()
+
+	s := &subscription{taskIDs: make(map[string]bool)}
+
+	for {
+		select {
+		case <-app.shutdown:
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"), time.Now().Add(websocketWriteTimeout))
+			return
+		case <-closed:
+			return
+		case <-ping.C:
+			if e := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(websocketWriteTimeout)); e != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow to keep up with the events"), time.Now().Add(websocketWriteTimeout))
+				return
+			}
+			response, ok := websocketEvent(event, s)
+			if ok && !send(response) {
+				return
+			}
+		case request := <-requests:
+			if !send(app.handleWebsocketRequest(eventContext(r), request, s)) {
+				return
+			}
+		}
+	}
+}
+
+func (app *application) handleWebsocketRequest(ctx context.Context, request websocketRequest, s *subscription) websocketResponse {
+	response := websocketResponse{Ref: request.Ref, Type: "ack"}
+
+	switch request.Type {
+	case "subscribe", "unsubscribe":
+		s.update(request.Type == "subscribe", request.TaskIDs)
+	case "operation":
+		v := validator.New()
+		if request.batchOperation.validate(v, "operation"); !v.Valid() {
+			response.Type = "error"
+			response.Error = v.Errors
+			return response
+		}
+
+		results, e := applyOperations(app.repositories.Tasks.WithContext(ctx), []batchOperation{request.batchOperation})
+		if e != nil {
+			app.logger.Error(e, nil)
+			response.Type = "error"
+			response.Error = "the server encountered a problem and could not process your request"
+			return response
+		}
+
+		app.publishResults(ctx, results)
+
+		response.Result = &results[0]
+		if results[0].failed() {
+			response.Type = "error"
+		}
+	case "invalid":
+		response.Type = "error"
+		response.Error = "message must be a well-formed JSON object"
+	default:
+		response.Type = "error"
+		response.Error = "type must be one of subscribe, unsubscribe or operation"
+	}
+
+	return response
+}
+
+func websocketEvent(event messaging.Event, s *subscription) (websocketResponse, bool) {
+	response := websocketResponse{Event: event.Type, EventID: event.ID, Type: "event"}
+
+	switch event.Type {
+	case "created", "updated":
+		var task data.Task
+		if e := json.Unmarshal([]byte(event.Payload), &task); e != nil {
+			return response, false
+		}
+		response.Task = &task
+		response.TaskID = task.ID
+	case "deleted":
+		if e := json.Unmarshal([]byte(event.Payload), &response.TaskID); e != nil {
+			return response, false
+		}
+	default:
+		return response, false
+	}
+
+	return response, s.follows(response.TaskID)
+}
@@ -3,35 +3,106 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/thomascastle/tarsk/internal/config"
 	"github.com/thomascastle/tarsk/internal/data"
 	"github.com/thomascastle/tarsk/internal/messaging"
+	"github.com/thomascastle/tarsk/internal/metrics"
 	"github.com/thomascastle/tarsk/internal/search"
 	"github.com/thomascastle/tarsk/internal/structuredlog"
+	"github.com/thomascastle/tarsk/internal/tracing"
+	"github.com/thomascastle/tarsk/internal/validator"
 )
 
+type configuration struct {
+	elasticsearch search.Config
+	log           structuredlog.Config
+	metrics       struct {
+		port int
+	}
+	redis   messaging.Config
+	tracing tracing.Config
+}
+
 type application struct {
-	logger  *structuredlog.Logger
-	indexer *search.TaskIndexer
+	config   configuration
+	consumed *metrics.Counter
+	failed   *metrics.Counter
+	indexed  *metrics.Counter
+	logger   *structuredlog.Logger
+	indexer  *search.TaskIndexer
+	registry *metrics.Registry
+	tracer   *tracing.Tracer
 }
 
 func main() {
+	var cfg configuration
+
+	config.Elasticsearch(flag.CommandLine, &cfg.elasticsearch)
+
+	config.Logging(flag.CommandLine, &cfg.log)
+
+	flag.IntVar(&cfg.metrics.port, "metrics-port", 4001, "Port of the metrics server, 0 to disable it")
+
+	config.Redis(flag.CommandLine, &cfg.redis)
+
+	config.Tracing(flag.CommandLine, &cfg.tracing)
+
 	logger := structuredlog.New(os.Stdout, structuredlog.LevelInfo)
 
-	s_client, e := search.NewClient()
+	e := config.Parse(flag.CommandLine, os.Args[1:])
+	if errors.Is(e, config.ErrorPrintedConfig) {
+		os.Exit(0)
+	}
+	if e != nil {
+		logger.Fatal(e, nil)
+	}
+
+	v := validator.New()
+	config.ValidateElasticsearch(v, cfg.elasticsearch)
+	v.Check(cfg.metrics.port >= 0 && cfg.metrics.port <= 65535, "metrics-port", "must be a valid port")
+	config.ValidateRedis(v, cfg.redis)
+	if !v.Valid() {
+		logger.Fatal(errors.New("invalid configuration"), map[string]any{"errors": v.Errors})
+	}
+
+	logger.Configure(cfg.log)
+	slog.SetDefault(slog.New(logger.Handler()))
+
+	s_client, e := search.NewClient(cfg.elasticsearch)
 	if e != nil {
 		logger.Fatal(e, nil)
 	}
 
 	logger.Info("search client created", nil)
 
+	tracer, exporter, e := tracing.NewTracerFromConfig("tarsk-indexer", cfg.tracing)
+	if e != nil {
+		logger.Fatal(e, nil)
+	}
+	defer exporter.Close()
+
+	registry := metrics.NewRegistry()
+
 	app := &application{
-		logger:  logger,
-		indexer: search.NewTaskIndexer(s_client),
+		config:   cfg,
+		consumed: registry.Counter("tarsk_indexer_events_consumed_total", "Events received by the indexer.", "event"),
+		failed:   registry.Counter("tarsk_indexer_events_failed_total", "Events which could not be decoded or applied to the index.", "event"),
+		indexed:  registry.Counter("tarsk_indexer_events_indexed_total", "Events applied to the index.", "event"),
+		logger:   logger,
+		indexer:  search.NewTaskIndexer(s_client, cfg.elasticsearch.Index),
+		registry: registry,
+		tracer:   tracer,
 	}
 
 	e = app.serve()
@@ -41,13 +112,34 @@ func main() {
 }
 
 func (app *application) serve() error {
-	r_client, e := messaging.NewClient()
+	r_client, e := messaging.NewClient(app.config.redis)
 	if e != nil {
 		return e
 	}
 
 	pubsub := r_client.PSubscribe(context.Background(), "tasks.*")
 
+	var metricsServer *http.Server
+	if app.config.metrics.port != 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", app.registry.Handler())
+
+		metricsServer = &http.Server{
+			Addr:         fmt.Sprintf(":%d", app.config.metrics.port),
+			Handler:      mux,
+			IdleTimeout:  time.Minute,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 30 * time.Second,
+		}
+
+		go func() {
+			e := metricsServer.ListenAndServe()
+			if e != nil && !errors.Is(e, http.ErrServerClosed) {
+				app.logger.Error(fmt.Errorf("metrics server failed: %w", e), nil)
+			}
+		}()
+	}
+
 	errorShuttingDown := make(chan error)
 
 	go func() {
@@ -55,7 +147,14 @@ func (app *application) serve() error {
 		signal.Notify(signalQuitting, syscall.SIGINT, syscall.SIGTERM)
 		s := <-signalQuitting // blocks until a signal is received
 
-		app.logger.Info("server shutting down...", map[string]string{"signal": s.String()})
+		app.logger.Info("server shutting down...", map[string]any{"signal": s.String()})
+
+		if metricsServer != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			metricsServer.Shutdown(ctx)
+		}
 
 		e := pubsub.Close()
 		if e != nil {
@@ -76,28 +175,31 @@ func (app *application) serve() error {
 
 	go func() {
 		for message := range messagePublished {
-			app.logger.Info("message received on: "+message.Channel, nil)
-
-			switch message.Channel {
-			case "tasks.event.created", "tasks.event.updated":
-				var task data.Task
-				if e := json.NewDecoder(strings.NewReader(message.Payload)).Decode(&task); e != nil {
-					app.logger.Info("invalid message: "+e.Error(), nil)
-					continue
-				}
-				if e := app.indexer.Index(context.Background(), task); e != nil {
-					app.logger.Info("failed to index the task: "+e.Error(), nil)
-				}
-			case "tasks.event.deleted":
-				var id string
-				if e := json.NewDecoder(strings.NewReader(message.Payload)).Decode(&id); e != nil {
-					app.logger.Info("invalid message: "+e.Error(), nil)
-					continue
-				}
-				if e := app.indexer.Delete(context.Background(), id); e != nil {
-					app.logger.Info("failed to delete the task: "+e.Error(), nil)
-				}
+			published := messaging.DecodeMessage(message.Payload)
+			logger := app.logger.With(map[string]any{"request_id": published.RequestID})
+
+			logger.Info("message received on: "+message.Channel, nil)
+
+			event := strings.TrimPrefix(message.Channel, "tasks.event.")
+			app.consumed.Inc(event)
+
+			// The span continues the trace of the request which published
+			// the event.
+			ctx := tracing.ContextWithRemoteParent(context.Background(), published.Traceparent)
+			ctx, span := app.tracer.Start(ctx, "consume "+message.Channel)
+			span.SetAttribute("request_id", published.RequestID)
+
+			e := app.handle(ctx, message.Channel, published.Data)
+			span.RecordError(e)
+			span.End()
+
+			if e != nil {
+				logger.Error(e, nil)
+				app.failed.Inc(event)
+				continue
 			}
+
+			app.indexed.Inc(event)
 		}
 
 		app.logger.Info("No more message to consume!", nil)
@@ -112,3 +214,29 @@ func (app *application) serve() error {
 
 	return nil
 }
+
+// handle applies an event to the index.
+func (app *application) handle(ctx context.Context, channel string, body_JSON []byte) error {
+	switch channel {
+	case "tasks.event.created", "tasks.event.updated":
+		var task data.Task
+		if e := json.Unmarshal(body_JSON, &task); e != nil {
+			return fmt.Errorf("invalid message: %w", e)
+		}
+		if e := app.indexer.Index(ctx, task); e != nil {
+			return fmt.Errorf("failed to index the task: %w", e)
+		}
+	case "tasks.event.deleted":
+		var id string
+		if e := json.Unmarshal(body_JSON, &id); e != nil {
+			return fmt.Errorf("invalid message: %w", e)
+		}
+		if e := app.indexer.Delete(ctx, id); e != nil {
+			return fmt.Errorf("failed to delete the task: %w", e)
+		}
+	default:
+		return fmt.Errorf("unknown event: %s", channel)
+	}
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	_ "github.com/lib/pq"
+	"github.com/thomascastle/tarsk/internal/config"
+	"github.com/thomascastle/tarsk/internal/data"
+	"github.com/thomascastle/tarsk/internal/messaging"
+	"github.com/thomascastle/tarsk/internal/structuredlog"
+	"github.com/thomascastle/tarsk/internal/validator"
+	"github.com/thomascastle/tarsk/internal/webhooks"
+)
+
+// consumerGroup is the consumer group of the event stream the dispatchers
+// share, so that each event is enqueued once.
+const consumerGroup = "webhook-dispatcher"
+
+type configuration struct {
+	batch    int
+	consumer string
+	db       struct {
+		dsn string
+	}
+	interval time.Duration
+	log      structuredlog.Config
+	redis    messaging.Config
+}
+
+type application struct {
+	config     configuration
+	dispatcher *webhooks.Dispatcher
+	logger     *structuredlog.Logger
+}
+
+func main() {
+	var cfg configuration
+
+	flag.IntVar(&cfg.batch, "batch", 50, "Maximum deliveries attempted concurrently per interval")
+
+	hostname, _ := os.Hostname()
+	flag.StringVar(&cfg.consumer, "consumer", hostname, "Name of this dispatcher in the consumer group of the event stream, unique per instance")
+
+	flag.StringVar(&cfg.db.dsn, "db-dsn", "", "Data Source Name")
+
+	flag.DurationVar(&cfg.interval, "interval", 5*time.Second, "How often due deliveries are attempted")
+
+	config.Logging(flag.CommandLine, &cfg.log)
+
+	config.Redis(flag.CommandLine, &cfg.redis)
+
+	logger := structuredlog.New(os.Stdout, structuredlog.LevelInfo)
+
+	e := config.Parse(flag.CommandLine, os.Args[1:])
+	if errors.Is(e, config.ErrorPrintedConfig) {
+		os.Exit(0)
+	}
+	if e != nil {
+		logger.Fatal(e, nil)
+	}
+
+	v := validator.New()
+	v.Check(cfg.batch > 0, "batch", "must be greater than zero")
+	v.Check(cfg.batch <= 500, "batch", "must not be more than 500")
+	v.Check(cfg.consumer != "", "consumer", "is required")
+	v.Check(cfg.db.dsn != "", "db-dsn", "is required")
+	v.Check(cfg.interval > 0, "interval", "must be greater than zero")
+	config.ValidateRedis(v, cfg.redis)
+	if !v.Valid() {
+		logger.Fatal(errors.New("invalid configuration"), map[string]any{"errors": v.Errors})
+	}
+
+	logger.Configure(cfg.log)
+	slog.SetDefault(slog.New(logger.Handler()))
+
+	db, e := sql.Open("postgres", cfg.db.dsn)
+	if e != nil {
+		logger.Fatal(e, nil)
+	}
+	defer db.Close()
+
+	e = db.Ping()
+	if e != nil {
+		logger.Fatal(e, nil)
+	}
+
+	logger.Info("database connection pool established", nil)
+
+	app := &application{
+		config:     cfg,
+		dispatcher: webhooks.NewDispatcher(data.NewRepositories(db)),
+		logger:     logger,
+	}
+
+	e = app.serve()
+	if e != nil {
+		logger.Fatal(e, nil)
+	}
+}
+
+func (app *application) serve() error {
+	r_client, e := messaging.NewClient(app.config.redis)
+	if e != nil {
+		return e
+	}
+	defer r_client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	consumer, e := messaging.NewStreamConsumer(ctx, r_client, consumerGroup, app.config.consumer)
+	if e != nil {
+		return e
+	}
+
+	go func() {
+		signalQuitting := make(chan os.Signal, 1)
+		signal.Notify(signalQuitting, syscall.SIGINT, syscall.SIGTERM)
+		s := <-signalQuitting // blocks until a signal is received
+
+		app.logger.Info("server shutting down...", map[string]any{"signal": s.String()})
+
+		cancel()
+	}()
+
+	app.logger.Info("server started", nil)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		app.consume(ctx, consumer)
+	}()
+
+	go func() {
+		defer wg.Done()
+		app.deliver(ctx)
+	}()
+
+	wg.Wait()
+
+	app.logger.Info("server stopped", nil)
+
+	return nil
+}
+
+// consume enqueues the deliveries of the events read from the stream until
+// ctx is done. An event is acknowledged once its deliveries are recorded, so
+// that an event which could not be enqueued is read again, if need be by the
+// next dispatcher to start.
+func (app *application) consume(ctx context.Context, consumer *messaging.StreamConsumer) {
+	for ctx.Err() == nil {
+		events, e := consumer.Read(ctx, 5*time.Second)
+		if e != nil {
+			if ctx.Err() == nil {
+				app.logger.Error(fmt.Errorf("failed to read events: %w", e), nil)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		for _, event := range events {
+			logger := app.logger.With(map[string]any{"request_id": event.RequestID})
+
+			logger.Info("event received: "+event.Type, nil)
+
+			e := app.dispatcher.Enqueue(event.Type, []byte(event.Payload))
+			if e != nil && !errors.Is(e, webhooks.ErrorUnknownEvent) {
+				logger.Error(fmt.Errorf("failed to enqueue deliveries: %w", e), nil)
+
+				consumer.Retry()
+				time.Sleep(time.Second)
+				break
+			}
+			if e != nil {
+				logger.Error(e, nil)
+			}
+
+			if e := consumer.Ack(ctx, event.ID); e != nil {
+				logger.Error(fmt.Errorf("failed to acknowledge the event: %w", e), nil)
+			}
+		}
+	}
+}
+
+// deliver attempts the due deliveries every interval until ctx is done.
+func (app *application) deliver(ctx context.Context) {
+	ticker := time.NewTicker(app.config.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Keep delivering while full batches are claimed, so that a
+			// backlog drains faster than one batch per interval.
+			for {
+				n, e := app.dispatcher.DeliverDue(ctx, app.config.batch)
+				if e != nil {
+					app.logger.Error(fmt.Errorf("failed to deliver: %w", e), nil)
+				}
+				if e != nil || n < app.config.batch || ctx.Err() != nil {
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    fingerprint CHAR(64) NOT NULL,
+    key VARCHAR(255) PRIMARY KEY,
+    response_body BYTEA,
+    response_headers JSONB,
+    response_status INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
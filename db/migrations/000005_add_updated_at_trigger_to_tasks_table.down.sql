@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS tasks_set_updated_at ON tasks;
+
+DROP FUNCTION IF EXISTS tasks_set_updated_at();
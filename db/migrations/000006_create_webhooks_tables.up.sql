@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    events TEXT[] DEFAULT '{}' NOT NULL,
+    id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+    secret VARCHAR NOT NULL,
+    url VARCHAR NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    attempts INTEGER DEFAULT 0 NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    event VARCHAR NOT NULL,
+    id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+    next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR DEFAULT 'pending' NOT NULL,
+    webhook_id UUID NOT NULL REFERENCES webhooks ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id, created_at);
+
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+    attempted_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    delivery_id UUID NOT NULL REFERENCES webhook_deliveries ON DELETE CASCADE,
+    duration_ms INTEGER NOT NULL,
+    error VARCHAR DEFAULT '' NOT NULL,
+    id BIGSERIAL PRIMARY KEY,
+    response_status INTEGER DEFAULT 0 NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhook_delivery_attempts_delivery_id_idx ON webhook_delivery_attempts (delivery_id);
@@ -0,0 +1,164 @@
+// Package config declares the configuration shared by the commands and loads
+// it in layers: flag defaults, then a configuration file, then environment
+// variables, then flags, each overriding the previous ones.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/thomascastle/tarsk/internal/messaging"
+	"github.com/thomascastle/tarsk/internal/search"
+	"github.com/thomascastle/tarsk/internal/structuredlog"
+	"github.com/thomascastle/tarsk/internal/tracing"
+	"github.com/thomascastle/tarsk/internal/validator"
+)
+
+// Redis declares the flags configuring the Redis client.
+func Redis(fs *flag.FlagSet, c *messaging.Config) {
+	fs.StringVar(&c.Addr, "redis-addr", "localhost:6379", "Redis address (host:port)")
+	fs.IntVar(&c.DB, "redis-db", 0, "Redis database index")
+	fs.StringVar(&c.Password, "redis-password", "", "Redis password")
+	fs.BoolVar(&c.TLS, "redis-tls", false, "Connect to Redis over TLS")
+}
+
+func ValidateRedis(v *validator.Validator, c messaging.Config) {
+	v.Check(c.Addr != "", "redis-addr", "is required")
+	v.Check(c.DB >= 0, "redis-db", "must not be negative")
+}
+
+// Elasticsearch declares the flags configuring the Elasticsearch client.
+func Elasticsearch(fs *flag.FlagSet, c *search.Config) {
+	c.Addresses = []string{"http://localhost:9200"}
+	fs.Var((*list)(&c.Addresses), "elasticsearch-addresses", "Comma-separated list of Elasticsearch node URLs")
+	fs.StringVar(&c.CACert, "elasticsearch-ca-cert", "", "Path to a PEM CA certificate to trust for Elasticsearch")
+	fs.StringVar(&c.Index, "elasticsearch-index", "tasks", "Elasticsearch index of the tasks")
+	fs.StringVar(&c.Password, "elasticsearch-password", "", "Elasticsearch password")
+	fs.StringVar(&c.Username, "elasticsearch-username", "", "Elasticsearch username")
+}
+
+func ValidateElasticsearch(v *validator.Validator, c search.Config) {
+	v.Check(len(c.Addresses) > 0, "elasticsearch-addresses", "is required")
+	for _, address := range c.Addresses {
+		u, e := url.Parse(address)
+		v.Check(e == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "elasticsearch-addresses", "must only contain absolute http or https URLs")
+	}
+	v.Check(c.Index != "", "elasticsearch-index", "is required")
+}
+
+// Logging declares the flags configuring the logger.
+func Logging(fs *flag.FlagSet, c *structuredlog.Config) {
+	c.Level = structuredlog.LevelInfo
+	c.StackLevel = structuredlog.LevelFatal
+	fs.Var(&c.Level, "log-level", "Minimum level of the logged entries (debug|info|warn|error|fatal|off)")
+	fs.Var(&c.StackLevel, "log-stack-level", "Minimum level of the logged entries with a stack trace (debug|info|warn|error|fatal|off)")
+}
+
+// Tracing declares the flags configuring the export of spans.
+func Tracing(fs *flag.FlagSet, c *tracing.Config) {
+	fs.StringVar(&c.File, "trace-file", "", "Path of a file to append spans to as JSON lines, empty to disable tracing")
+}
+
+// ErrorPrintedConfig is returned by Parse once it has printed the
+// configuration, upon which the command exits.
+var ErrorPrintedConfig = errors.New("configuration printed")
+
+// Parse loads the values of the flags of fs. It declares two more flags:
+// -config, the path of a JSON, TOML or YAML file (also read from
+// TARSK_CONFIG), and -print-config, which prints the effective configuration
+// with its secrets redacted to stdout and returns ErrorPrintedConfig. Neither
+// may be set in the file, nor -print-config in the environment.
+//
+// A flag given in args wins over its environment variable, named after the
+// flag with a TARSK_ prefix (-redis-addr is read from TARSK_REDIS_ADDR),
+// which wins over the file, which wins over the flag's default.
+func Parse(fs *flag.FlagSet, args []string) error {
+	path := fs.String("config", "", "Path of a JSON, TOML or YAML configuration file")
+	printConfig := fs.Bool("print-config", false, "Print the configuration with secrets redacted and exit")
+
+	if e := fs.Parse(args); e != nil {
+		return e
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	if !explicit["config"] {
+		if value, found := os.LookupEnv(EnvName("config")); found {
+			*path = value
+		}
+	}
+
+	if *path != "" {
+		values, e := readFile(*path)
+		if e != nil {
+			return e
+		}
+
+		for name, value := range values {
+			if fs.Lookup(name) == nil || name == "config" || name == "print-config" {
+				return fmt.Errorf("%s: unknown setting %q", *path, name)
+			}
+			if explicit[name] {
+				continue
+			}
+
+			if e := fs.Set(name, value); e != nil {
+				return fmt.Errorf("%s: invalid value %q for %s: %w", *path, value, name, e)
+			}
+		}
+	}
+
+	for _, name := range names(fs) {
+		value, found := os.LookupEnv(EnvName(name))
+		if !found || explicit[name] || name == "config" || name == "print-config" {
+			continue
+		}
+
+		if e := fs.Set(name, value); e != nil {
+			return fmt.Errorf("invalid value %q for %s: %w", value, EnvName(name), e)
+		}
+	}
+
+	if *printConfig {
+		if e := Print(os.Stdout, fs); e != nil {
+			return e
+		}
+		return ErrorPrintedConfig
+	}
+
+	return nil
+}
+
+// EnvName returns the environment variable of a flag.
+func EnvName(flagName string) string {
+	return "TARSK_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// list is a flag holding comma-separated values.
+type list []string
+
+func (l *list) String() string {
+	if l == nil {
+		return ""
+	}
+
+	return strings.Join(*l, ",")
+}
+
+func (l *list) Set(value string) error {
+	*l = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+
+	return nil
+}
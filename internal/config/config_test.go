@@ -0,0 +1,112 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newFlagSet(values map[string]*string) *flag.FlagSet {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	for _, name := range []string{"from-default", "from-file", "from-env", "from-flag"} {
+		values[name] = fs.String(name, "default", "")
+	}
+
+	return fs
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if e := os.WriteFile(path, []byte(content), 0o600); e != nil {
+		t.Fatal(e)
+	}
+
+	return path
+}
+
+func TestParsePrecedence(t *testing.T) {
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"config.json", `{"from-file": "file", "from-env": "file", "from": {"flag": "file"}}`},
+		{"config.toml", "from-file = \"file\"\nfrom-env = \"file\"\n\n[from]\nflag = \"file\"\n"},
+		{"config.yaml", "from-file: file\nfrom-env: file\nfrom:\n  flag: file\n"},
+	}
+
+	for _, file := range files {
+		t.Run(file.name, func(t *testing.T) {
+			t.Setenv("TARSK_CONFIG", writeFile(t, file.name, file.content))
+			t.Setenv("TARSK_FROM_ENV", "env")
+			t.Setenv("TARSK_FROM_FLAG", "env")
+
+			values := make(map[string]*string)
+			fs := newFlagSet(values)
+
+			if e := Parse(fs, []string{"-from-flag", "flag"}); e != nil {
+				t.Fatalf("Parse() = %v", e)
+			}
+
+			want := map[string]string{"from-default": "default", "from-file": "file", "from-env": "env", "from-flag": "flag"}
+			for name, value := range want {
+				if *values[name] != value {
+					t.Errorf("%s = %q, want %q", name, *values[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestParseConfigFlagWinsOverEnv(t *testing.T) {
+	t.Setenv("TARSK_CONFIG", filepath.Join(t.TempDir(), "missing.json"))
+
+	values := make(map[string]*string)
+	fs := newFlagSet(values)
+
+	path := writeFile(t, "config.json", `{"from-file": "file"}`)
+	if e := Parse(fs, []string{"-config", path}); e != nil {
+		t.Fatalf("Parse() = %v", e)
+	}
+	if *values["from-file"] != "file" {
+		t.Errorf("from-file = %q, want file", *values["from-file"])
+	}
+}
+
+func TestParseRejectsInvalidFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"config.json", `{"unknown": "value"}`},
+		{"config.json", `{"print-config": true}`},
+		{"config.toml", `config = "other.toml"`},
+		{"config.yaml", "from-file:\n"},
+		{"config.ini", "from-file = file"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name+" "+test.content, func(t *testing.T) {
+			fs := newFlagSet(make(map[string]*string))
+
+			if e := Parse(fs, []string{"-config", writeFile(t, test.name, test.content)}); e == nil {
+				t.Error("Parse() = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestParsePrintConfig(t *testing.T) {
+	t.Setenv("TARSK_PRINT_CONFIG", "true")
+
+	if e := Parse(newFlagSet(make(map[string]*string)), nil); e != nil {
+		t.Errorf("Parse() with TARSK_PRINT_CONFIG = %v, want nil", e)
+	}
+
+	if e := Parse(newFlagSet(make(map[string]*string)), []string{"-print-config"}); !errors.Is(e, ErrorPrintedConfig) {
+		t.Errorf("Parse(-print-config) = %v, want %v", e, ErrorPrintedConfig)
+	}
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// readFile reads a configuration file into flag values. Settings are named
+// after the flags, either flat or nested by their dash-separated prefix:
+//
+//	{"db-dsn": "postgres://...", "redis": {"addr": "redis:6379", "db": 1}}
+//
+// Lists may be written as arrays.
+func readFile(path string) (map[string]string, error) {
+	content, e := os.ReadFile(path)
+	if e != nil {
+		return nil, e
+	}
+
+	var document map[string]interface{}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		e = json.Unmarshal(content, &document)
+	case ".toml":
+		e = toml.Unmarshal(content, &document)
+	case ".yaml", ".yml":
+		e = yaml.Unmarshal(content, &document)
+	default:
+		return nil, fmt.Errorf("%s: the configuration file must be .json, .toml, .yaml or .yml", path)
+	}
+	if e != nil {
+		return nil, fmt.Errorf("%s: %w", path, e)
+	}
+
+	values := make(map[string]string)
+	if e := flatten(values, "", document); e != nil {
+		return nil, fmt.Errorf("%s: %w", path, e)
+	}
+
+	return values, nil
+}
+
+func flatten(values map[string]string, prefix string, document map[string]interface{}) error {
+	for key, value := range document {
+		name := key
+		if prefix != "" {
+			name = prefix + "-" + key
+		}
+
+		switch value := value.(type) {
+		case map[string]interface{}:
+			if e := flatten(values, name, value); e != nil {
+				return e
+			}
+		case []interface{}:
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			values[name] = strings.Join(items, ",")
+		case float64:
+			values[name] = strconv.FormatFloat(value, 'f', -1, 64)
+		case nil:
+			return fmt.Errorf("%s has no value", name)
+		default:
+			values[name] = fmt.Sprint(value)
+		}
+	}
+
+	return nil
+}
+
+// Print writes the values of the flags of fs as a JSON configuration file,
+// with secrets redacted.
+func Print(w io.Writer, fs *flag.FlagSet) error {
+	values := make(map[string]string)
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || f.Name == "print-config" {
+			return
+		}
+		values[f.Name] = redact(f.Name, f.Value.String())
+	})
+
+	// encoding/json sorts the keys of maps.
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "\t")
+
+	return encoder.Encode(values)
+}
+
+// redact hides the values of secret settings. The password of a DSN is
+// redacted while the rest is kept, as it tells which database is used.
+func redact(name, value string) string {
+	if value == "" {
+		return value
+	}
+
+	for _, secret := range []string{"password", "secret", "token"} {
+		if strings.Contains(name, secret) {
+			return "REDACTED"
+		}
+	}
+
+	if strings.HasSuffix(name, "dsn") {
+		u, e := url.Parse(value)
+		if e != nil || u.Scheme == "" {
+			return "REDACTED"
+		}
+		if _, found := u.User.Password(); found {
+			u.User = url.UserPassword(u.User.Username(), "REDACTED")
+		}
+		if u.Query().Has("password") {
+			query := u.Query()
+			query.Set("password", "REDACTED")
+			u.RawQuery = query.Encode()
+		}
+		return u.String()
+	}
+
+	return value
+}
+
+// names returns the names of the flags of fs, sorted.
+func names(fs *flag.FlagSet) []string {
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) {
+		names = append(names, f.Name)
+	})
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,98 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrorInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks the last row of a page so the next page can be fetched with a
+// keyset condition over (sort fields, id) instead of an OFFSET.
+type Cursor struct {
+	ID     string        `json:"id"`
+	Sort   string        `json:"sort"`
+	Values []interface{} `json:"values"`
+}
+
+func newCursor(sort Sort, keys []sortKey, task *Task) *Cursor {
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		values[i] = task.sortValue(key.Field)
+	}
+
+	return &Cursor{
+		ID:     task.ID,
+		Sort:   sort.Sort,
+		Values: values,
+	}
+}
+
+func (c *Cursor) Encode() string {
+	data_JSON, e := json.Marshal(c)
+	if e != nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data_JSON)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	data_JSON, e := base64.RawURLEncoding.DecodeString(s)
+	if e != nil {
+		return nil, ErrorInvalidCursor
+	}
+
+	var raw struct {
+		ID     string            `json:"id"`
+		Sort   string            `json:"sort"`
+		Values []json.RawMessage `json:"values"`
+	}
+
+	if e := json.Unmarshal(data_JSON, &raw); e != nil {
+		return nil, ErrorInvalidCursor
+	}
+	if raw.ID == "" || raw.Sort == "" {
+		return nil, ErrorInvalidCursor
+	}
+
+	keys := Sort{Sort: raw.Sort}.keys()
+	if len(keys) != len(raw.Values) {
+		return nil, ErrorInvalidCursor
+	}
+
+	cursor := &Cursor{ID: raw.ID, Sort: raw.Sort, Values: make([]interface{}, len(keys))}
+
+	for i, key := range keys {
+		value, e := decodeSortValue(key.Field, raw.Values[i])
+		if e != nil {
+			return nil, ErrorInvalidCursor
+		}
+		cursor.Values[i] = value
+	}
+
+	return cursor, nil
+}
+
+func decodeSortValue(field string, raw json.RawMessage) (interface{}, error) {
+	if string(raw) == "null" {
+		return nil, nil
+	}
+
+	switch field {
+	case "created_at", "due_at", "started_at", "updated_at":
+		var t time.Time
+		e := json.Unmarshal(raw, &t)
+		return t, e
+	case "priority":
+		var rank int
+		e := json.Unmarshal(raw, &rank)
+		return rank, e
+	default:
+		var s string
+		e := json.Unmarshal(raw, &s)
+		return s, e
+	}
+}
@@ -0,0 +1,68 @@
+package data
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	day := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		sort   string
+		values []interface{}
+	}{
+		{"time", "-created_at", []interface{}{day}},
+		{"NULL", "due_at", []interface{}{nil}},
+		{"priority rank", "priority", []interface{}{2}},
+		{"several keys", "description,-started_at", []interface{}{"Buy milk", day}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cursor := &Cursor{ID: "42", Sort: test.sort, Values: test.values}
+
+			got, e := DecodeCursor(cursor.Encode())
+			if e != nil {
+				t.Fatalf("DecodeCursor() = %v", e)
+			}
+			if !reflect.DeepEqual(got, cursor) {
+				t.Errorf("DecodeCursor() = %+v, want %+v", got, cursor)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "not a cursor!"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"id":"42","sort":"due_at","values":[null]}`))},
+		{"not JSON", encode(`id=42`)},
+		{"no id", encode(`{"sort":"due_at","values":[null]}`)},
+		{"no sort", encode(`{"id":"42","values":[]}`)},
+		{"fewer values than keys", encode(`{"id":"42","sort":"due_at,description","values":[null]}`)},
+		{"more values than keys", encode(`{"id":"42","sort":"due_at","values":[null,"Buy milk"]}`)},
+		{"text for a date", encode(`{"id":"42","sort":"due_at","values":["tomorrow"]}`)},
+		{"text for a priority", encode(`{"id":"42","sort":"priority","values":["high"]}`)},
+		{"number for text", encode(`{"id":"42","sort":"description","values":[1]}`)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if cursor, e := DecodeCursor(test.cursor); !errors.Is(e, ErrorInvalidCursor) {
+				t.Errorf("DecodeCursor() = %+v, %v, want %v", cursor, e, ErrorInvalidCursor)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/thomascastle/tarsk/internal/validator"
+)
+
+// Fieldset holds a comma-separated list of the task fields a client wants in a
+// response. An empty list stands for every field.
+type Fieldset struct {
+	Fields         string
+	FieldsSafelist []string
+}
+
+func (f Fieldset) fields() []string {
+	return splitList(f.Fields)
+}
+
+// columns returns the columns to select so that the requested fields as well
+// as the ones needed to order and paginate the rows are loaded.
+func (f Fieldset) columns(keys []sortKey) []string {
+	fields := f.fields()
+	if len(fields) == 0 {
+		return TaskFields
+	}
+
+	columns := []string{"id"}
+	for _, field := range fields {
+		if !validator.In(field, columns...) {
+			columns = append(columns, field)
+		}
+	}
+	for _, key := range keys {
+		if !validator.In(key.Field, columns...) {
+			columns = append(columns, key.Field)
+		}
+	}
+
+	return columns
+}
+
+// Project returns the task restricted to the requested fields.
+func (f Fieldset) Project(task *Task) interface{} {
+	fields := f.fields()
+	if len(fields) == 0 {
+		return task
+	}
+
+	projection := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		projection[field] = task.fieldValue(field)
+	}
+
+	return projection
+}
+
+func (f Fieldset) ProjectAll(tasks []*Task) []interface{} {
+	projections := make([]interface{}, len(tasks))
+	for i, task := range tasks {
+		projections[i] = f.Project(task)
+	}
+
+	return projections
+}
+
+func (f Fieldset) Validate(v *validator.Validator) {
+	validateList(v, "fields", f.fields(), f.FieldsSafelist)
+}
+
+func splitList(s string) []string {
+	if strings.TrimSpace(s) == "" {
+		return nil
+	}
+
+	var values []string
+	for _, value := range strings.Split(s, ",") {
+		values = append(values, strings.TrimSpace(value))
+	}
+
+	return values
+}
+
+func validateList(v *validator.Validator, key string, values []string, safelist []string) {
+	for _, value := range values {
+		if !validator.In(value, safelist...) {
+			v.AddError(key, fmt.Sprintf("invalid %s value %q", key, value))
+		}
+	}
+
+	v.Check(validator.Unique(values), key, "must not contain duplicate values")
+}
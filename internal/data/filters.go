@@ -3,44 +3,194 @@ package data
 import (
 	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/thomascastle/tarsk/internal/validator"
 )
 
+// Filters maps a filter name to its parsed value. A value which could not be
+// parsed is kept as the raw string so that Validate can report it.
 type Filters map[string]interface{}
 
+var dateFilters = []string{"due_after", "due_before", "started_after", "started_before"}
+
+// FilterNames lists the names of the filters understood by ParseFilters.
+var FilterNames = append([]string{"description", "done", "overdue", "priority", "priority_gte"}, dateFilters...)
+
 func (f Filters) Validate(v *validator.Validator) {
-	if value, present := f["done"]; present {
-		_, ok := value.(bool)
-		if !ok {
-			v.AddError("done", "invalid value")
+	for _, key := range []string{"done", "overdue"} {
+		if value, present := f[key]; present {
+			_, ok := value.(bool)
+			if !ok {
+				v.AddError(key, "must be a boolean value")
+			}
+		}
+	}
+
+	for _, key := range dateFilters {
+		if value, present := f[key]; present {
+			_, ok := value.(time.Time)
+			if !ok {
+				v.AddError(key, "must be a date (2006-01-02) or an RFC 3339 timestamp")
+			}
 		}
 	}
 
 	if value, present := f["priority"]; present {
-		priority, ok := value.(Priority)
+		priorities, ok := value.([]Priority)
 		if !ok {
 			v.AddError("priority", "invalid value")
 		}
+		for _, priority := range priorities {
+			if !priority.Valid() {
+				v.AddError("priority", "invalid value")
+			}
+		}
+	}
+
+	if value, present := f["priority_gte"]; present {
+		priority, ok := value.(Priority)
+		if !ok {
+			v.AddError("priority_gte", "invalid value")
+		}
 		if !priority.Valid() {
-			v.AddError("priority", "invalid value")
+			v.AddError("priority_gte", "invalid value")
+		}
+	}
+
+	if after, ok := f["due_after"].(time.Time); ok {
+		if before, ok := f["due_before"].(time.Time); ok {
+			v.Check(after.Before(before), "due_after", "must be before due_before")
+		}
+	}
+	if after, ok := f["started_after"].(time.Time); ok {
+		if before, ok := f["started_before"].(time.Time); ok {
+			v.Check(after.Before(before), "started_after", "must be before started_before")
+		}
+	}
+}
+
+// where compiles the filters into a parameterized SQL condition using ? as the
+// placeholder. It returns an empty string when there is nothing to filter on.
+func (f Filters) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if search, ok := f["description"].(string); ok {
+		conditions = append(conditions, "to_tsvector('simple', description) @@ plainto_tsquery('simple', ?)")
+		args = append(args, search)
+	}
+
+	if done, ok := f["done"].(bool); ok {
+		conditions = append(conditions, "done = ?")
+		args = append(args, done)
+	}
+
+	if t, ok := f["due_after"].(time.Time); ok {
+		conditions = append(conditions, "due_at > ?")
+		args = append(args, t)
+	}
+	if t, ok := f["due_before"].(time.Time); ok {
+		conditions = append(conditions, "due_at < ?")
+		args = append(args, t)
+	}
+	if t, ok := f["started_after"].(time.Time); ok {
+		conditions = append(conditions, "started_at > ?")
+		args = append(args, t)
+	}
+	if t, ok := f["started_before"].(time.Time); ok {
+		conditions = append(conditions, "started_at < ?")
+		args = append(args, t)
+	}
+
+	if overdue, ok := f["overdue"].(bool); ok {
+		if overdue {
+			conditions = append(conditions, "(done = FALSE AND due_at < ?)")
+		} else {
+			conditions = append(conditions, "(done = TRUE OR due_at IS NULL OR due_at >= ?)")
 		}
+		args = append(args, time.Now().UTC())
+	}
+
+	if priorities, ok := f["priority"].([]Priority); ok {
+		condition, priorityArgs := priorityIn(priorities)
+		conditions = append(conditions, condition)
+		args = append(args, priorityArgs...)
+	}
+	if priority, ok := f["priority_gte"].(Priority); ok {
+		condition, priorityArgs := priorityIn(priority.AtLeast())
+		conditions = append(conditions, condition)
+		args = append(args, priorityArgs...)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+func priorityIn(priorities []Priority) (string, []interface{}) {
+	if len(priorities) == 0 {
+		return "FALSE", nil
+	}
+
+	placeholders := make([]string, len(priorities))
+	args := make([]interface{}, len(priorities))
+	for i, priority := range priorities {
+		placeholders[i] = "?"
+		args[i] = string(priority)
 	}
+
+	return "priority IN (" + strings.Join(placeholders, ", ") + ")", args
 }
 
 func ParseFilters(values url.Values) Filters {
 	filters := make(map[string]interface{})
-	done_string := values.Get("done")
-	if done_string != "" {
-		if done, e := strconv.ParseBool(done_string); e == nil {
-			filters["done"] = done
+
+	if value := values.Get("description"); value != "" {
+		filters["description"] = value
+	}
+
+	for _, key := range []string{"done", "overdue"} {
+		if value := values.Get(key); value != "" {
+			if b, e := strconv.ParseBool(value); e == nil {
+				filters[key] = b
+			} else {
+				filters[key] = value
+			}
+		}
+	}
+
+	for _, key := range dateFilters {
+		if value := values.Get(key); value != "" {
+			if t, e := parseDate(value); e == nil {
+				filters[key] = t
+			} else {
+				filters[key] = value
+			}
 		}
 	}
 
 	priority := values.Get("priority")
 	if priority != "" {
-		filters["priority"] = Priority(priority)
+		var priorities []Priority
+		for _, value := range strings.Split(priority, ",") {
+			priorities = append(priorities, Priority(strings.TrimSpace(value)))
+		}
+		filters["priority"] = priorities
+	}
+
+	priority_gte := values.Get("priority_gte")
+	if priority_gte != "" {
+		filters["priority_gte"] = Priority(priority_gte)
 	}
 
 	return filters
 }
+
+func parseDate(value string) (time.Time, error) {
+	t, e := time.Parse(time.RFC3339, value)
+	if e == nil {
+		return t.UTC(), nil
+	}
+
+	return time.Parse("2006-01-02", value)
+}
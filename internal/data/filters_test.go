@@ -0,0 +1,107 @@
+package data
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/thomascastle/tarsk/internal/validator"
+)
+
+// now stands for the current time among the expected arguments.
+type now struct{}
+
+func TestFiltersWhere(t *testing.T) {
+	may := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	june := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		query     string
+		condition string
+		args      []interface{}
+	}{
+		{"", "", nil},
+		{"description=buy+milk", "to_tsvector('simple', description) @@ plainto_tsquery('simple', ?)", []interface{}{"buy milk"}},
+		{"done=true", "done = ?", []interface{}{true}},
+		{"due_after=2024-05-01&due_before=2024-06-01T12:00:00%2B02:00", "due_at > ? AND due_at < ?", []interface{}{may, june}},
+		{"started_after=2024-05-01&started_before=2024-06-01T10:00:00Z", "started_at > ? AND started_at < ?", []interface{}{may, june}},
+		{"overdue=true", "(done = FALSE AND due_at < ?)", []interface{}{now{}}},
+		{"overdue=false", "(done = TRUE OR due_at IS NULL OR due_at >= ?)", []interface{}{now{}}},
+		{"priority=high,+low", "priority IN (?, ?)", []interface{}{"high", "low"}},
+		{"priority_gte=medium", "priority IN (?, ?)", []interface{}{"medium", "high"}},
+		{"priority_gte=none", "priority IN (?, ?, ?, ?)", []interface{}{"none", "low", "medium", "high"}},
+		{"priority_gte=urgent", "FALSE", nil},
+		{
+			"priority_gte=high&due_before=2024-05-01&done=false",
+			"done = ? AND due_at < ? AND priority IN (?)",
+			[]interface{}{false, may, "high"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			values, e := url.ParseQuery(test.query)
+			if e != nil {
+				t.Fatal(e)
+			}
+
+			start := time.Now()
+			condition, args := ParseFilters(values).where()
+
+			if condition != test.condition {
+				t.Errorf("condition = %s, want %s", condition, test.condition)
+			}
+			if len(args) != len(test.args) {
+				t.Fatalf("args = %v, want %v", args, test.args)
+			}
+			for i, want := range test.args {
+				if _, ok := want.(now); ok {
+					if got, ok := args[i].(time.Time); !ok || got.Before(start) || got.After(time.Now()) {
+						t.Errorf("args[%d] = %v, want the current time", i, args[i])
+					}
+					continue
+				}
+				if !reflect.DeepEqual(args[i], want) {
+					t.Errorf("args[%d] = %#v, want %#v", i, args[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestFiltersValidate(t *testing.T) {
+	tests := []struct {
+		query  string
+		errors []string
+	}{
+		{"done=false&overdue=1&priority=high,none&priority_gte=low&due_after=2024-05-01&due_before=2024-05-02", nil},
+		{"done=maybe&overdue=soon", []string{"done", "overdue"}},
+		{"due_after=tomorrow&started_before=2024-13-01", []string{"due_after", "started_before"}},
+		{"priority=high,urgent", []string{"priority"}},
+		{"priority_gte=urgent", []string{"priority_gte"}},
+		{"due_after=2024-05-02&due_before=2024-05-01", []string{"due_after"}},
+		{"started_after=2024-05-01&started_before=2024-05-01", []string{"started_after"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			values, e := url.ParseQuery(test.query)
+			if e != nil {
+				t.Fatal(e)
+			}
+
+			v := validator.New()
+			ParseFilters(values).Validate(v)
+
+			if len(v.Errors) != len(test.errors) {
+				t.Errorf("errors = %v, want errors for %v", v.Errors, test.errors)
+			}
+			for _, key := range test.errors {
+				if _, found := v.Errors[key]; !found {
+					t.Errorf("errors = %v, want an error for %s", v.Errors, key)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// IdempotencyRecord is the response stored for an Idempotency-Key. A record
+// whose ResponseStatus is zero belongs to a request still being processed,
+// which holds the key until LockedUntil.
+type IdempotencyRecord struct {
+	Fingerprint     string
+	Key             string
+	LockedUntil     time.Time
+	ResponseBody    []byte
+	ResponseHeaders map[string][]string
+	ResponseStatus  int
+}
+
+type IdempotencyRepository struct {
+	DB *sql.DB
+}
+
+// Reserve claims the key for a request with the given fingerprint, for the
+// duration of lease. It returns the record of the reservation and true when
+// the key was free, or held by a request whose lease expired without a
+// response being stored, such as one of a server which crashed; it returns
+// the record stored for the key and false otherwise.
+func (r IdempotencyRepository) Reserve(key, fingerprint string, lease, ttl time.Duration) (*IdempotencyRecord, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, e := r.DB.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE key = $1 AND expires_at < NOW()`, key)
+	if e != nil {
+		return nil, false, e
+	}
+
+	query := `
+		INSERT INTO idempotency_keys (expires_at, fingerprint, key, locked_until)
+		VALUES (NOW() + $1 * INTERVAL '1 second', $2, $3, NOW() + $4 * INTERVAL '1 second')
+		ON CONFLICT (key) DO UPDATE
+		SET expires_at = EXCLUDED.expires_at, fingerprint = EXCLUDED.fingerprint, locked_until = EXCLUDED.locked_until
+		WHERE idempotency_keys.response_status IS NULL AND idempotency_keys.locked_until < NOW()
+		RETURNING locked_until`
+
+	args := []interface{}{int64(ttl.Seconds()), fingerprint, key, int64(lease.Seconds())}
+
+	reservation := IdempotencyRecord{Fingerprint: fingerprint, Key: key}
+
+	e = r.DB.QueryRowContext(ctx, query, args...).Scan(&reservation.LockedUntil)
+	if e == nil {
+		return &reservation, true, nil
+	}
+	if !errors.Is(e, sql.ErrNoRows) {
+		return nil, false, e
+	}
+
+	query = `
+		SELECT fingerprint, key, locked_until, response_body, response_headers, response_status
+		FROM idempotency_keys
+		WHERE key = $1`
+
+	var record IdempotencyRecord
+	var headers []byte
+	var status sql.NullInt64
+
+	e = r.DB.QueryRowContext(ctx, query, key).Scan(
+		&record.Fingerprint,
+		&record.Key,
+		&record.LockedUntil,
+		&record.ResponseBody,
+		&headers,
+		&status,
+	)
+	if e != nil {
+		return nil, false, e
+	}
+
+	record.ResponseStatus = int(status.Int64)
+
+	if headers != nil {
+		if e := json.Unmarshal(headers, &record.ResponseHeaders); e != nil {
+			return nil, false, e
+		}
+	}
+
+	return &record, false, nil
+}
+
+// Complete stores the response of the request which reserved the key, unless
+// another request took the key over meanwhile.
+func (r IdempotencyRepository) Complete(record *IdempotencyRecord) error {
+	headers, e := json.Marshal(record.ResponseHeaders)
+	if e != nil {
+		return e
+	}
+
+	query := `
+		UPDATE idempotency_keys
+		SET response_body=$1, response_headers=$2, response_status=$3
+		WHERE key=$4 AND locked_until=$5`
+
+	args := []interface{}{record.ResponseBody, headers, record.ResponseStatus, record.Key, record.LockedUntil}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, e = r.DB.ExecContext(ctx, query, args...)
+
+	return e
+}
+
+// Release frees a key whose request did not complete so that it can be
+// retried, unless another request took the key over meanwhile.
+func (r IdempotencyRepository) Release(reservation *IdempotencyRecord) error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE key=$1 AND locked_until=$2 AND response_status IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, e := r.DB.ExecContext(ctx, query, reservation.Key, reservation.LockedUntil)
+
+	return e
+}
+
+func (r IdempotencyRepository) DeleteExpired() error {
+	query := `
+		DELETE FROM idempotency_keys
+		WHERE expires_at < NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, e := r.DB.ExecContext(ctx, query)
+
+	return e
+}
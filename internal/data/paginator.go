@@ -7,8 +7,10 @@ import (
 )
 
 type Paginator struct {
-	Page  int
-	Limit int
+	Count  bool
+	Cursor *Cursor
+	Page   int
+	Limit  int
 }
 
 func (p Paginator) limit() int {
@@ -32,26 +34,42 @@ func (p Paginator) Validate(v *validator.Validator) {
 	if p.Page > 10_000_000 {
 		v.AddError("page", "must be a maximum of 10 million")
 	}
+	if p.Cursor != nil && p.Page != 1 {
+		v.AddError("page", "must not be combined with cursor")
+	}
 }
 
 type Pagination struct {
-	CurrentPage int `json:"current_page,omitempty"`
-	Limit       int `json:"limit,omitempty"`
-	FirstPage   int `json:"first_page,omitempty"`
-	LastPage    int `json:"last_page,omitempty"`
-	Total       int `json:"total,omitempty"`
+	CurrentPage int    `json:"current_page,omitempty"`
+	Limit       int    `json:"limit,omitempty"`
+	FirstPage   int    `json:"first_page,omitempty"`
+	LastPage    int    `json:"last_page,omitempty"`
+	NextCursor  string `json:"next_cursor,omitempty"`
+	Total       int    `json:"total,omitempty"`
 }
 
-func buildPagination(page, limit, total int) Pagination {
-	if total == 0 {
+func buildPagination(paginator Paginator, total int, nextCursor *Cursor) Pagination {
+	if paginator.Count && total == 0 {
 		return Pagination{}
 	}
 
-	return Pagination{
-		CurrentPage: page,
-		Limit:       limit,
-		FirstPage:   1,
-		LastPage:    int(math.Ceil(float64(total) / float64(limit))),
-		Total:       total,
+	pagination := Pagination{
+		Limit: paginator.Limit,
+	}
+
+	if paginator.Cursor == nil {
+		pagination.CurrentPage = paginator.Page
+		pagination.FirstPage = 1
+	}
+
+	if paginator.Count {
+		pagination.LastPage = int(math.Ceil(float64(total) / float64(paginator.Limit)))
+		pagination.Total = total
+	}
+
+	if nextCursor != nil {
+		pagination.NextCursor = nextCursor.Encode()
 	}
+
+	return pagination
 }
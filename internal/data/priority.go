@@ -9,6 +9,9 @@ const (
 	PriorityHigh   Priority = "high"
 )
 
+// priorities lists every priority from the lowest to the highest.
+var priorities = []Priority{PriorityNone, PriorityLow, PriorityMedium, PriorityHigh}
+
 func (p Priority) Valid() bool {
 	switch p {
 	case PriorityNone, PriorityLow, PriorityMedium, PriorityHigh:
@@ -17,3 +20,25 @@ func (p Priority) Valid() bool {
 
 	return false
 }
+
+// AtLeast returns the priorities that are equal to or higher than p.
+func (p Priority) AtLeast() []Priority {
+	for i, priority := range priorities {
+		if priority == p {
+			return priorities[i:]
+		}
+	}
+
+	return nil
+}
+
+// rank orders priorities from the lowest (0) to the highest.
+func (p Priority) rank() int {
+	for i, priority := range priorities {
+		if priority == p {
+			return i
+		}
+	}
+
+	return -1
+}
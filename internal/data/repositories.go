@@ -1,8 +1,13 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/thomascastle/tarsk/internal/tracing"
 )
 
 var (
@@ -11,11 +16,93 @@ var (
 )
 
 type Repositories struct {
-	Tasks TaskRepository
+	Idempotency       IdempotencyRepository
+	Tasks             TaskRepository
+	WebhookDeliveries WebhookDeliveryRepository
+	Webhooks          WebhookRepository
 }
 
 func NewRepositories(db *sql.DB) Repositories {
 	return Repositories{
-		Tasks: TaskRepository{DB: db},
+		Idempotency:       IdempotencyRepository{DB: db},
+		Tasks:             TaskRepository{DB: db},
+		WebhookDeliveries: WebhookDeliveryRepository{DB: db},
+		Webhooks:          WebhookRepository{DB: db},
+	}
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// tracedQueryer records a span for each query, as a child of the span carried
+// by the context of the query.
+type tracedQueryer struct {
+	queryer
+}
+
+func (q tracedQueryer) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	defer span.End()
+
+	result, e := q.queryer.ExecContext(ctx, query, args...)
+	span.RecordError(e)
+
+	return result, e
+}
+
+func (q tracedQueryer) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuerySpan(ctx, query)
+	defer span.End()
+
+	rows, e := q.queryer.QueryContext(ctx, query, args...)
+	span.RecordError(e)
+
+	return rows, e
+}
+
+func (q tracedQueryer) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuerySpan(ctx, query)
+	defer span.End()
+
+	row := q.queryer.QueryRowContext(ctx, query, args...)
+	span.RecordError(row.Err())
+
+	return row
+}
+
+func startQuerySpan(ctx context.Context, query string) (context.Context, *tracing.Span) {
+	statement := strings.Join(strings.Fields(query), " ")
+
+	operation := statement
+	if i := strings.IndexByte(statement, ' '); i > 0 {
+		operation = statement[:i]
 	}
+
+	ctx, span := tracing.Start(ctx, "postgres "+operation)
+	span.SetAttribute("db.statement", statement)
+	span.SetAttribute("db.system", "postgresql")
+
+	return ctx, span
+}
+
+// rebind replaces the ? placeholders of a condition built for GORM with the
+// numbered placeholders expected by the Postgres driver.
+func rebind(query string) string {
+	var b strings.Builder
+
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
 }
@@ -14,10 +14,10 @@ type Search struct {
 	index  string
 }
 
-func NewSearch(client *elasticsearch.Client) *Search {
+func NewSearch(client *elasticsearch.Client, index string) *Search {
 	return &Search{
 		client: client,
-		index:  "tasks",
+		index:  index,
 	}
 }
 
@@ -112,12 +112,14 @@ func (i *Search) Query(ctx context.Context, params SearchParams) (SearchResults,
 	hits := make([]Task, len(results.Hits.Hits))
 
 	for i, hit := range results.Hits.Hits {
+		hits[i].CreatedAt = hit.Source.CreatedAt
 		hits[i].Description = hit.Source.Description
 		hits[i].Done = hit.Source.Done
 		hits[i].DueAt = hit.Source.DueAt
 		hits[i].ID = hit.Source.ID
 		hits[i].Priority = hit.Source.Priority
 		hits[i].StartedAt = hit.Source.StartedAt
+		hits[i].UpdatedAt = hit.Source.UpdatedAt
 	}
 
 	return SearchResults{
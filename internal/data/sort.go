@@ -1,32 +1,106 @@
 package data
 
 import (
+	"errors"
+	"fmt"
 	"strings"
 
 	"github.com/thomascastle/tarsk/internal/validator"
 )
 
+var ErrorUnsafeSort = errors.New("unsafe sort parameter")
+
+// sortExpressions maps every sortable field to the SQL expression it is
+// ordered by. Priorities are ordered by their rank rather than by the
+// declaration order of the Postgres enum.
+var sortExpressions = map[string]string{
+	"created_at":  "created_at",
+	"description": "description",
+	"due_at":      "due_at",
+	"priority":    priorityRankExpression(),
+	"started_at":  "started_at",
+	"updated_at":  "updated_at",
+}
+
+// nullableSortFields are the sortable fields whose column accepts NULL.
+var nullableSortFields = []string{"due_at", "started_at"}
+
+// Sort holds a comma-separated list of fields, each optionally prefixed with
+// "-" for descending order. Rows are always ordered by id last so that the
+// order is deterministic.
 type Sort struct {
 	Sort         string
 	SortSafelist []string
 }
 
-func (s Sort) sortColumn() string {
-	for _, safeValue := range s.SortSafelist {
-		if s.Sort == safeValue {
-			return strings.TrimPrefix(s.Sort, "-")
-		}
+type sortKey struct {
+	Desc  bool
+	Field string
+}
+
+func (k sortKey) expression() string {
+	return sortExpressions[k.Field]
+}
+
+func (k sortKey) nullable() bool {
+	return validator.In(k.Field, nullableSortFields...)
+}
+
+func (s Sort) keys() []sortKey {
+	var keys []sortKey
+
+	for _, value := range strings.Split(s.Sort, ",") {
+		value = strings.TrimSpace(value)
+		keys = append(keys, sortKey{
+			Desc:  strings.HasPrefix(value, "-"),
+			Field: strings.TrimPrefix(value, "-"),
+		})
 	}
 
-	panic("unsafe sort parameter: " + s.Sort)
+	return keys
+}
+
+func (s Sort) safe(key sortKey) bool {
+	_, known := sortExpressions[key.Field]
+
+	return known && validator.In(key.Field, s.SortSafelist...)
 }
 
-func (s Sort) sortDesc() bool {
-	return strings.HasPrefix(s.Sort, "-")
+func (s Sort) orderBy() ([]sortKey, error) {
+	keys := s.keys()
+
+	for _, key := range keys {
+		if !s.safe(key) {
+			return nil, fmt.Errorf("%w: %s", ErrorUnsafeSort, s.Sort)
+		}
+	}
+
+	return keys, nil
 }
 
 func (s Sort) Validate(v *validator.Validator) {
-	if !validator.In(s.Sort, s.SortSafelist...) {
-		v.AddError("sort", "invalid sort value")
+	keys := s.keys()
+
+	fields := make([]string, len(keys))
+	for i, key := range keys {
+		fields[i] = key.Field
+
+		if !s.safe(key) {
+			v.AddError("sort", fmt.Sprintf("invalid sort value %q", key.Field))
+		}
 	}
+
+	v.Check(validator.Unique(fields), "sort", "must not contain duplicate fields")
+}
+
+func priorityRankExpression() string {
+	var b strings.Builder
+
+	b.WriteString("CASE priority")
+	for rank, priority := range priorities {
+		fmt.Fprintf(&b, " WHEN '%s' THEN %d", priority, rank)
+	}
+	b.WriteString(" END")
+
+	return b.String()
 }
@@ -0,0 +1,71 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/thomascastle/tarsk/internal/validator"
+)
+
+var testSortSafelist = []string{"created_at", "description", "due_at", "priority"}
+
+func TestSortValidate(t *testing.T) {
+	tests := []struct {
+		sort  string
+		valid bool
+	}{
+		{"due_at", true},
+		{"-priority, due_at,description", true},
+		{"", false},
+		{"-", false},
+		{"due_at,", false},
+		{"due_at,-due_at", false},
+		{"id", false},
+		{"started_at", false},
+		{"due_at;DROP TABLE tasks", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.sort, func(t *testing.T) {
+			v := validator.New()
+			Sort{Sort: test.sort, SortSafelist: testSortSafelist}.Validate(v)
+
+			if v.Valid() != test.valid {
+				t.Errorf("Validate() errors = %v, want valid %v", v.Errors, test.valid)
+			}
+		})
+	}
+}
+
+func TestSortOrderBy(t *testing.T) {
+	keys, e := Sort{Sort: "-priority, due_at", SortSafelist: testSortSafelist}.orderBy()
+	if e != nil {
+		t.Fatalf("orderBy() = %v", e)
+	}
+
+	want := []sortKey{{Desc: true, Field: "priority"}, {Field: "due_at"}}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("orderBy() = %+v, want %+v", keys, want)
+	}
+	if expression := keys[0].expression(); expression != priorityRankExpression() {
+		t.Errorf("priority is ordered by %s, want its rank", expression)
+	}
+}
+
+func TestSortOrderByRejectsUnsafe(t *testing.T) {
+	for _, sort := range []string{"", "id", "started_at", "-due_at,title", "due_at DESC"} {
+		t.Run(sort, func(t *testing.T) {
+			if keys, e := (Sort{Sort: sort, SortSafelist: testSortSafelist}).orderBy(); !errors.Is(e, ErrorUnsafeSort) {
+				t.Errorf("orderBy() = %+v, %v, want %v", keys, e, ErrorUnsafeSort)
+			}
+		})
+	}
+}
+
+func TestPriorityRankExpression(t *testing.T) {
+	want := "CASE priority WHEN 'none' THEN 0 WHEN 'low' THEN 1 WHEN 'medium' THEN 2 WHEN 'high' THEN 3 END"
+	if got := priorityRankExpression(); got != want {
+		t.Errorf("priorityRankExpression() = %s, want %s", got, want)
+	}
+}
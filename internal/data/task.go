@@ -3,48 +3,178 @@ package data
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/thomascastle/tarsk/internal/tracing"
 	"github.com/thomascastle/tarsk/internal/validator"
 )
 
 type Task struct {
+	CreatedAt   time.Time `json:"created_at"`
 	Description string    `json:"description"`
 	Done        bool      `json:"done"`
 	DueAt       time.Time `json:"due_at"`
 	ID          string    `json:"id"`
 	Priority    Priority  `json:"priority"`
 	StartedAt   time.Time `json:"started_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// MarshalJSON renders the optional dates of the task, DueAt and StartedAt, as
+// null when they are not set.
+func (t Task) MarshalJSON() ([]byte, error) {
+	type task Task
+
+	return json.Marshal(struct {
+		task
+		DueAt     *time.Time `json:"due_at"`
+		StartedAt *time.Time `json:"started_at"`
+	}{
+		task:      task(t),
+		DueAt:     timeOrNil(t.DueAt),
+		StartedAt: timeOrNil(t.StartedAt),
+	})
+}
+
+// TaskFields lists the JSON names of the fields of a task, which are also the
+// names of their columns.
+var TaskFields = []string{"created_at", "description", "done", "due_at", "id", "priority", "started_at", "updated_at"}
+
 type TaskRepository struct {
-	DB *sql.DB
+	DB  *sql.DB
+	ctx context.Context
+	tx  *sql.Tx
+}
+
+// WithContext returns a copy of the repository whose queries are traced as
+// children of the span carried by ctx. Their timeouts do not depend on ctx,
+// which is not used otherwise.
+func (r TaskRepository) WithContext(ctx context.Context) TaskRepository {
+	r.ctx = tracing.ContextWithSpan(context.Background(), tracing.SpanFromContext(ctx))
+
+	return r
+}
+
+func (r TaskRepository) context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+
+	return context.Background()
+}
+
+func (r TaskRepository) conn() queryer {
+	if r.tx != nil {
+		return tracedQueryer{r.tx}
+	}
+
+	return tracedQueryer{r.DB}
+}
+
+// Transaction calls fn with a repository whose queries all run in a single
+// transaction, which is committed if fn returns nil and rolled back otherwise.
+func (r TaskRepository) Transaction(fn func(tasks TaskRepository) error) error {
+	ctx, cancel := context.WithTimeout(r.context(), 15*time.Second)
+	defer cancel()
+
+	tx, e := r.DB.BeginTx(ctx, nil)
+	if e != nil {
+		return e
+	}
+
+	e = fn(TaskRepository{DB: r.DB, ctx: r.ctx, tx: tx})
+	if e != nil {
+		tx.Rollback()
+		return e
+	}
+
+	return tx.Commit()
 }
 
 func (r TaskRepository) Insert(task *Task) error {
 	query := `
 		INSERT INTO tasks (description, due_at, priority, started_at)
 		VALUES ($1, $2, $3, $4)
-		RETURNING id`
+		RETURNING created_at, id, updated_at`
 
-	args := []interface{}{task.Description, task.DueAt, task.Priority, task.StartedAt}
+	args := []interface{}{task.Description, nullTime(task.DueAt), task.Priority, nullTime(task.StartedAt)}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(r.context(), 3*time.Second)
 	defer cancel()
 
-	return r.DB.QueryRowContext(ctx, query, args...).Scan(&task.ID)
+	return r.conn().QueryRowContext(ctx, query, args...).Scan(&task.CreatedAt, &task.ID, &task.UpdatedAt)
+}
+
+// InsertMany inserts the tasks with a single statement and returns them as
+// stored. The returned tasks are not necessarily in the order of the input.
+func (r TaskRepository) InsertMany(tasks []*Task) ([]*Task, error) {
+	if len(tasks) == 0 {
+		return []*Task{}, nil
+	}
+
+	var values []string
+	var args []interface{}
+	for _, task := range tasks {
+		n := len(args)
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5))
+		args = append(args, task.Description, task.Done, nullTime(task.DueAt), task.Priority, nullTime(task.StartedAt))
+	}
+
+	query := `
+		INSERT INTO tasks (description, done, due_at, priority, started_at)
+		VALUES ` + strings.Join(values, ", ") + `
+		RETURNING created_at, description, done, due_at, id, priority, started_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(r.context(), 3*time.Second)
+	defer cancel()
+
+	rows, e := r.conn().QueryContext(ctx, query, args...)
+	if e != nil {
+		return nil, e
+	}
+	defer rows.Close()
+
+	inserted := make([]*Task, 0, len(tasks))
+	for rows.Next() {
+		var task Task
+		e := rows.Scan(
+			&task.CreatedAt,
+			&task.Description,
+			&task.Done,
+			timeScanner{&task.DueAt},
+			&task.ID,
+			&task.Priority,
+			timeScanner{&task.StartedAt},
+			&task.UpdatedAt,
+		)
+		if e != nil {
+			return nil, e
+		}
+
+		inserted = append(inserted, &task)
+	}
+
+	if e := rows.Err(); e != nil {
+		return nil, e
+	}
+
+	return inserted, nil
 }
 
 func (r TaskRepository) Select() ([]*Task, error) {
 	query := `
-		SELECT description, done, due_at, id, priority, started_at
+		SELECT created_at, description, done, due_at, id, priority, started_at, updated_at
 		FROM tasks`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(r.context(), 3*time.Second)
 	defer cancel()
 
-	rows, e := r.DB.QueryContext(ctx, query)
+	rows, e := r.conn().QueryContext(ctx, query)
 	if e != nil {
 		return nil, e
 	}
@@ -54,12 +184,14 @@ func (r TaskRepository) Select() ([]*Task, error) {
 	for rows.Next() {
 		var task Task
 		e := rows.Scan(
+			&task.CreatedAt,
 			&task.Description,
 			&task.Done,
-			&task.DueAt,
+			timeScanner{&task.DueAt},
 			&task.ID,
 			&task.Priority,
-			&task.StartedAt,
+			timeScanner{&task.StartedAt},
+			&task.UpdatedAt,
 		)
 		if e != nil {
 			return nil, e
@@ -75,23 +207,131 @@ func (r TaskRepository) Select() ([]*Task, error) {
 	return tasks, nil
 }
 
+// SelectFiltered returns at most limit tasks matching the filters, the ones
+// due first. Within a transaction the rows are locked until it ends.
+func (r TaskRepository) SelectFiltered(filters *Filters, limit int) ([]*Task, error) {
+	condition, args := filters.where()
+	if condition == "" {
+		condition = "TRUE"
+	}
+
+	query := `
+		SELECT created_at, description, done, due_at, id, priority, started_at, updated_at
+		FROM tasks
+		WHERE ` + rebind(condition) + `
+		ORDER BY due_at, id
+		LIMIT ` + strconv.Itoa(limit)
+
+	if r.tx != nil {
+		query += `
+		FOR UPDATE`
+	}
+
+	ctx, cancel := context.WithTimeout(r.context(), 3*time.Second)
+	defer cancel()
+
+	rows, e := r.conn().QueryContext(ctx, query, args...)
+	if e != nil {
+		return nil, e
+	}
+	defer rows.Close()
+
+	tasks := []*Task{}
+	for rows.Next() {
+		var task Task
+		e := rows.Scan(
+			&task.CreatedAt,
+			&task.Description,
+			&task.Done,
+			timeScanner{&task.DueAt},
+			&task.ID,
+			&task.Priority,
+			timeScanner{&task.StartedAt},
+			&task.UpdatedAt,
+		)
+		if e != nil {
+			return nil, e
+		}
+
+		tasks = append(tasks, &task)
+	}
+
+	if e := rows.Err(); e != nil {
+		return nil, e
+	}
+
+	return tasks, nil
+}
+
+// Each calls fn with every task matching the filters, one row at a time, so
+// that large results are not held in memory. It stops at the first error
+// returned by fn.
+func (r TaskRepository) Each(filters *Filters, fn func(task *Task) error) error {
+	condition, args := filters.where()
+	if condition == "" {
+		condition = "TRUE"
+	}
+
+	query := `
+		SELECT created_at, description, done, due_at, id, priority, started_at, updated_at
+		FROM tasks
+		WHERE ` + rebind(condition) + `
+		ORDER BY due_at, id`
+
+	// Consumers such as exports write every row to a client, which takes
+	// longer than a regular query.
+	ctx, cancel := context.WithTimeout(r.context(), 5*time.Minute)
+	defer cancel()
+
+	rows, e := r.conn().QueryContext(ctx, query, args...)
+	if e != nil {
+		return e
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var task Task
+		e := rows.Scan(
+			&task.CreatedAt,
+			&task.Description,
+			&task.Done,
+			timeScanner{&task.DueAt},
+			&task.ID,
+			&task.Priority,
+			timeScanner{&task.StartedAt},
+			&task.UpdatedAt,
+		)
+		if e != nil {
+			return e
+		}
+
+		if e := fn(&task); e != nil {
+			return e
+		}
+	}
+
+	return rows.Err()
+}
+
 func (r TaskRepository) SelectOne(id string) (*Task, error) {
 	query := `
-		SELECT description, done, due_at, id, priority, started_at
+		SELECT created_at, description, done, due_at, id, priority, started_at, updated_at
 		FROM tasks
 		WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(r.context(), 3*time.Second)
 	defer cancel()
 
 	var task Task
-	e := r.DB.QueryRowContext(ctx, query, id).Scan(
+	e := r.conn().QueryRowContext(ctx, query, id).Scan(
+		&task.CreatedAt,
 		&task.Description,
 		&task.Done,
-		&task.DueAt,
+		timeScanner{&task.DueAt},
 		&task.ID,
 		&task.Priority,
-		&task.StartedAt,
+		timeScanner{&task.StartedAt},
+		&task.UpdatedAt,
 	)
 	if e != nil {
 		switch {
@@ -108,22 +348,24 @@ func (r TaskRepository) SelectOne(id string) (*Task, error) {
 func (r TaskRepository) Update(task *Task) error {
 	query := `
 		UPDATE tasks
-		SET description=$1, done=$2, due_at=$3, priority=$4, started_at=$5
-		WHERE id=$6`
+		SET description=$1, done=$2, due_at=$3, priority=$4, started_at=$5, updated_at=NOW()
+		WHERE id=$6 AND updated_at=$7
+		RETURNING updated_at`
 
 	args := []interface{}{
 		task.Description,
 		task.Done,
-		task.DueAt,
+		nullTime(task.DueAt),
 		task.Priority,
-		task.StartedAt,
+		nullTime(task.StartedAt),
 		task.ID,
+		task.UpdatedAt,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(r.context(), 3*time.Second)
 	defer cancel()
 
-	_, e := r.DB.ExecContext(ctx, query, args...)
+	e := r.conn().QueryRowContext(ctx, query, args...).Scan(&task.UpdatedAt)
 	if e != nil {
 		switch {
 		case errors.Is(e, sql.ErrNoRows):
@@ -141,10 +383,10 @@ func (r TaskRepository) Delete(id string) error {
 		DELETE FROM tasks
 		WHERE id=$1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(r.context(), 3*time.Second)
 	defer cancel()
 
-	result, e := r.DB.ExecContext(ctx, query, id)
+	result, e := r.conn().ExecContext(ctx, query, id)
 	if e != nil {
 		return e
 	}
@@ -165,10 +407,92 @@ func ValidateTask(v *validator.Validator, task *Task) {
 	v.Check(task.Description != "", "description", "is required")
 	v.Check(len(task.Description) <= 512, "description", "must not be more than 512 bytes long")
 
-	v.Check(!task.DueAt.IsZero(), "due_at", "is required")
-
 	v.Check(task.Priority.Valid(), "priority", "invalid value")
 
-	v.Check(!task.StartedAt.IsZero(), "started_at", "is required")
-	v.Check(!task.StartedAt.After(task.DueAt), "started_at", "date started must not be after due date")
+	if !task.DueAt.IsZero() && !task.StartedAt.IsZero() {
+		v.Check(!task.StartedAt.After(task.DueAt), "started_at", "date started must not be after due date")
+	}
+}
+
+func (t *Task) sortValue(field string) interface{} {
+	switch field {
+	case "created_at":
+		return t.CreatedAt
+	case "description":
+		return t.Description
+	case "due_at":
+		if t.DueAt.IsZero() {
+			return nil
+		}
+		return t.DueAt
+	case "priority":
+		return t.Priority.rank()
+	case "started_at":
+		if t.StartedAt.IsZero() {
+			return nil
+		}
+		return t.StartedAt
+	case "updated_at":
+		return t.UpdatedAt
+	default:
+		return nil
+	}
+}
+
+func (t *Task) fieldValue(field string) interface{} {
+	switch field {
+	case "created_at":
+		return t.CreatedAt
+	case "description":
+		return t.Description
+	case "done":
+		return t.Done
+	case "due_at":
+		return timeOrNil(t.DueAt)
+	case "id":
+		return t.ID
+	case "priority":
+		return t.Priority
+	case "started_at":
+		return timeOrNil(t.StartedAt)
+	case "updated_at":
+		return t.UpdatedAt
+	default:
+		return nil
+	}
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+// nullTime stores the zero time, an optional date which is not set, as NULL.
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+
+	return t
+}
+
+// timeScanner scans a nullable date, NULL being scanned as the zero time.
+type timeScanner struct {
+	t *time.Time
+}
+
+func (s timeScanner) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*s.t = time.Time{}
+	case time.Time:
+		*s.t = src
+	default:
+		return fmt.Errorf("unable to scan %T into a time", src)
+	}
+
+	return nil
 }
@@ -1,12 +1,19 @@
 package data
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/thomascastle/tarsk/internal/tracing"
+	"github.com/thomascastle/tarsk/internal/validator"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
 type TaskIndexRepository struct {
-	db *gorm.DB
+	ctx context.Context
+	db  *gorm.DB
 }
 
 func NewTaskIndexRepository(db *gorm.DB) TaskIndexRepository {
@@ -15,28 +22,160 @@ func NewTaskIndexRepository(db *gorm.DB) TaskIndexRepository {
 	}
 }
 
-func (r TaskIndexRepository) Select(search string, filters *Filters, sort Sort, paginator Paginator) ([]*Task, Pagination, error) {
+// WithContext returns a copy of the repository whose queries are traced as
+// children of the span carried by ctx, like TaskRepository.WithContext.
+func (r TaskIndexRepository) WithContext(ctx context.Context) TaskIndexRepository {
+	r.ctx = tracing.ContextWithSpan(context.Background(), tracing.SpanFromContext(ctx))
+
+	return r
+}
+
+func (r TaskIndexRepository) context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+
+	return context.Background()
+}
+
+func (r TaskIndexRepository) Select(filters *Filters, sort Sort, paginator Paginator, fieldset Fieldset) ([]*Task, Pagination, error) {
+	keys, e := sort.orderBy()
+	if e != nil {
+		return nil, Pagination{}, e
+	}
+
+	for _, field := range fieldset.fields() {
+		if !validator.In(field, TaskFields...) {
+			return nil, Pagination{}, fmt.Errorf("unknown task field: %s", field)
+		}
+	}
+
+	query := r.scope(filters).
+		Select(fieldset.columns(keys))
+
+	for _, key := range keys {
+		if key.Desc {
+			query = query.Order(key.expression() + " DESC")
+		} else {
+			query = query.Order(key.expression())
+		}
+	}
+	query = query.Order("id")
+
+	if paginator.Cursor != nil {
+		condition, args := keyset(keys, paginator.Cursor)
+		query = query.Where(condition, args...)
+	} else {
+		query = query.Offset(paginator.offset())
+	}
+
+	// One extra row is fetched to find out whether there is a next page.
 	var tasks []*Task
-	r.db.
-		Select([]string{"description", "done", "due_at", "id", "priority", "started_at"}).
-		Where(
-			r.db.Where("to_tsvector('simple', description) @@ plainto_tsquery('simple', ?)", search).Or("?=''", search),
-		).
-		Where(map[string]interface{}(*filters)).
-		Order(clause.OrderByColumn{Column: clause.Column{Name: sort.sortColumn()}, Desc: sort.sortDesc()}).
-		Offset(paginator.offset()).Limit(paginator.limit()).
-		Find(&tasks)
+	e = r.run(query.Limit(paginator.limit()+1), func(query *gorm.DB) *gorm.DB {
+		return query.Find(&tasks)
+	})
+	if e != nil {
+		return nil, Pagination{}, e
+	}
+
+	var nextCursor *Cursor
+	if len(tasks) > paginator.limit() {
+		tasks = tasks[:paginator.limit()]
+		nextCursor = newCursor(sort, keys, tasks[len(tasks)-1])
+	}
 
 	var total int64
-	r.db.
-		Model(&Task{}).
-		Where(
-			r.db.Where("to_tsvector('simple', description) @@ plainto_tsquery('simple', ?)", search).Or("?=''", search),
-		).
-		Where(map[string]interface{}(*filters)).
-		Count(&total)
+	if paginator.Count {
+		e := r.run(r.scope(filters).Model(&Task{}), func(query *gorm.DB) *gorm.DB {
+			return query.Count(&total)
+		})
+		if e != nil {
+			return nil, Pagination{}, e
+		}
+	}
 
-	pagination := buildPagination(paginator.Page, paginator.Limit, int(total))
+	pagination := buildPagination(paginator, int(total), nextCursor)
 
 	return tasks, pagination, nil
 }
+
+// run runs a query with a timeout, recording a span like tracedQueryer does.
+// GORM builds the statement as it runs the query, so the statement is
+// recorded afterwards, and the span is named after the only operation of the
+// repository.
+func (r TaskIndexRepository) run(query *gorm.DB, fn func(query *gorm.DB) *gorm.DB) error {
+	ctx, cancel := context.WithTimeout(r.context(), 3*time.Second)
+	defer cancel()
+
+	ctx, span := tracing.Start(ctx, "postgres SELECT")
+	defer span.End()
+
+	result := fn(query.WithContext(ctx))
+	span.SetAttribute("db.statement", result.Statement.SQL.String())
+	span.SetAttribute("db.system", "postgresql")
+	span.RecordError(result.Error)
+
+	return result.Error
+}
+
+func (r TaskIndexRepository) scope(filters *Filters) *gorm.DB {
+	query := r.db
+
+	if condition, args := filters.where(); condition != "" {
+		query = query.Where(condition, args...)
+	}
+
+	return query
+}
+
+// keyset builds the condition selecting the rows that come after the cursor in
+// the order given by keys and then id. Postgres puts NULLs last in ascending
+// order and first in descending order, so they are handled explicitly.
+func keyset(keys []sortKey, cursor *Cursor) (string, []interface{}) {
+	var alternatives []string
+	var args []interface{}
+
+	var equal []string
+	var equalArgs []interface{}
+
+	for i, key := range keys {
+		value := cursor.Values[i]
+		expression := key.expression()
+
+		var after string
+		var afterArgs []interface{}
+
+		switch {
+		case value == nil && key.Desc:
+			after = expression + " IS NOT NULL"
+		case value == nil:
+			// Nothing sorts after NULL in ascending order.
+		case key.Desc:
+			after = expression + " < ?"
+			afterArgs = []interface{}{value}
+		case key.nullable():
+			after = "(" + expression + " > ? OR " + expression + " IS NULL)"
+			afterArgs = []interface{}{value}
+		default:
+			after = expression + " > ?"
+			afterArgs = []interface{}{value}
+		}
+
+		if after != "" {
+			alternatives = append(alternatives, "("+strings.Join(append(equal[:len(equal):len(equal)], after), " AND ")+")")
+			args = append(append(args, equalArgs...), afterArgs...)
+		}
+
+		if value == nil {
+			equal = append(equal, expression+" IS NULL")
+		} else {
+			equal = append(equal, expression+" = ?")
+			equalArgs = append(equalArgs, value)
+		}
+	}
+
+	alternatives = append(alternatives, "("+strings.Join(append(equal, "id > ?"), " AND ")+")")
+	args = append(append(args, equalArgs...), cursor.ID)
+
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
@@ -0,0 +1,117 @@
+package data
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thomascastle/tarsk/internal/tracing"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestKeyset(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	priority := priorityRankExpression()
+
+	tests := []struct {
+		name      string
+		sort      string
+		values    []interface{}
+		condition string
+		args      []interface{}
+	}{
+		{
+			"ascending", "created_at", []interface{}{day},
+			"((created_at > ?) OR (created_at = ? AND id > ?))",
+			[]interface{}{day, day, "42"},
+		},
+		{
+			"descending", "-created_at", []interface{}{day},
+			"((created_at < ?) OR (created_at = ? AND id > ?))",
+			[]interface{}{day, day, "42"},
+		},
+		{
+			"ascending nullable", "due_at", []interface{}{day},
+			"(((due_at > ? OR due_at IS NULL)) OR (due_at = ? AND id > ?))",
+			[]interface{}{day, day, "42"},
+		},
+		{
+			"descending nullable", "-due_at", []interface{}{day},
+			"((due_at < ?) OR (due_at = ? AND id > ?))",
+			[]interface{}{day, day, "42"},
+		},
+		{
+			"ascending NULL", "due_at", []interface{}{nil},
+			"((due_at IS NULL AND id > ?))",
+			[]interface{}{"42"},
+		},
+		{
+			"descending NULL", "-due_at", []interface{}{nil},
+			"((due_at IS NOT NULL) OR (due_at IS NULL AND id > ?))",
+			[]interface{}{"42"},
+		},
+		{
+			"priority then NULL", "-priority,started_at", []interface{}{2, nil},
+			"((" + priority + " < ?) OR (" + priority + " = ? AND started_at IS NULL AND id > ?))",
+			[]interface{}{2, 2, "42"},
+		},
+		{
+			"nullable then text", "due_at,description", []interface{}{day, "Buy milk"},
+			"(((due_at > ? OR due_at IS NULL)) OR (due_at = ? AND description > ?) OR (due_at = ? AND description = ? AND id > ?))",
+			[]interface{}{day, day, "Buy milk", day, "Buy milk", "42"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			condition, args := keyset(Sort{Sort: test.sort}.keys(), &Cursor{ID: "42", Sort: test.sort, Values: test.values})
+
+			if condition != test.condition {
+				t.Errorf("condition = %s, want %s", condition, test.condition)
+			}
+			if !reflect.DeepEqual(args, test.args) {
+				t.Errorf("args = %v, want %v", args, test.args)
+			}
+		})
+	}
+}
+
+type recordingExporter struct {
+	spans []tracing.SpanData
+}
+
+func (e *recordingExporter) Export(span tracing.SpanData) {
+	e.spans = append(e.spans, span)
+}
+
+func TestTaskIndexRepositoryTracesQueries(t *testing.T) {
+	db, e := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DisableAutomaticPing: true, DryRun: true})
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	exporter := &recordingExporter{}
+	ctx, request := tracing.NewTracer("test", exporter).Start(context.Background(), "GET /v1/tasks")
+
+	filters := Filters{"done": false}
+	sort := Sort{Sort: "due_at", SortSafelist: []string{"due_at"}}
+	_, _, e = NewTaskIndexRepository(db).WithContext(ctx).Select(&filters, sort, Paginator{Count: true, Limit: 20, Page: 1}, Fieldset{})
+	if e != nil {
+		t.Fatalf("Select() = %v", e)
+	}
+	request.End()
+
+	if len(exporter.spans) != 3 {
+		t.Fatalf("exported %d spans, want the list, the count and the request", len(exporter.spans))
+	}
+	parent := exporter.spans[2].SpanID
+	for i, want := range []string{`FROM "tasks" WHERE done = $1 ORDER BY due_at,id LIMIT $2`, `SELECT count(*) FROM "tasks" WHERE done = $1`} {
+		span := exporter.spans[i]
+		if span.Name != "postgres SELECT" || span.Parent != parent || !strings.Contains(span.Attributes["db.statement"], want) {
+			t.Errorf("span %d = %s under %s: %s, want postgres SELECT under the request: ...%s", i, span.Name, span.Parent, span.Attributes["db.statement"], want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/thomascastle/tarsk/internal/validator"
+)
+
+func TestTaskJSONOptionalDates(t *testing.T) {
+	due := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	data_JSON, e := json.Marshal(&Task{Description: "Buy milk", DueAt: due, Priority: PriorityNone})
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	var doc map[string]interface{}
+	if e := json.Unmarshal(data_JSON, &doc); e != nil {
+		t.Fatal(e)
+	}
+	if doc["due_at"] != "2024-05-01T12:00:00Z" {
+		t.Errorf("due_at = %v, want 2024-05-01T12:00:00Z", doc["due_at"])
+	}
+	if value, found := doc["started_at"]; !found || value != nil {
+		t.Errorf("started_at = %v, want null", value)
+	}
+
+	var task Task
+	if e := json.Unmarshal(data_JSON, &task); e != nil {
+		t.Fatal(e)
+	}
+	if !task.DueAt.Equal(due) || !task.StartedAt.IsZero() {
+		t.Errorf("decoded due_at = %v, started_at = %v", task.DueAt, task.StartedAt)
+	}
+}
+
+func TestValidateTaskDates(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		due     time.Time
+		started time.Time
+		valid   bool
+	}{
+		{"no dates", time.Time{}, time.Time{}, true},
+		{"due only", day, time.Time{}, true},
+		{"started only", time.Time{}, day, true},
+		{"started before due", day.AddDate(0, 0, 1), day, true},
+		{"started after due", day, day.AddDate(0, 0, 1), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateTask(v, &Task{Description: "Call Mom", DueAt: test.due, Priority: PriorityNone, StartedAt: test.started})
+
+			if v.Valid() != test.valid {
+				t.Errorf("ValidateTask() errors = %v, want valid %v", v.Errors, test.valid)
+			}
+		})
+	}
+}
+
+func TestFieldsetProjectOptionalDates(t *testing.T) {
+	due := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fieldset := Fieldset{Fields: "due_at,started_at", FieldsSafelist: TaskFields}
+
+	data_JSON, e := json.Marshal(fieldset.Project(&Task{Description: "Buy milk", DueAt: due, Priority: PriorityNone}))
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	if want := `{"due_at":"2024-05-01T12:00:00Z","started_at":null}`; string(data_JSON) != want {
+		t.Errorf("projection = %s, want %s", data_JSON, want)
+	}
+}
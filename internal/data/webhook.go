@@ -0,0 +1,417 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/thomascastle/tarsk/internal/validator"
+)
+
+// WebhookEvents lists the task events a webhook can be notified of.
+var WebhookEvents = []string{"created", "updated", "deleted"}
+
+type Webhook struct {
+	CreatedAt time.Time `json:"created_at"`
+	Events    []string  `json:"events"`
+	ID        string    `json:"id"`
+	Secret    string    `json:"-"`
+	URL       string    `json:"url"`
+}
+
+// Accepts reports whether the webhook is notified of the event. A webhook
+// without events is notified of all of them.
+func (w *Webhook) Accepts(event string) bool {
+	return len(w.Events) == 0 || validator.In(event, w.Events...)
+}
+
+type WebhookRepository struct {
+	DB *sql.DB
+}
+
+func (r WebhookRepository) Insert(webhook *Webhook) error {
+	query := `
+		INSERT INTO webhooks (events, secret, url)
+		VALUES ($1, $2, $3)
+		RETURNING created_at, id`
+
+	args := []interface{}{pq.Array(webhook.Events), webhook.Secret, webhook.URL}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return r.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.CreatedAt, &webhook.ID)
+}
+
+func (r WebhookRepository) Select() ([]*Webhook, error) {
+	query := `
+		SELECT created_at, events, id, secret, url
+		FROM webhooks
+		ORDER BY created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, e := r.DB.QueryContext(ctx, query)
+	if e != nil {
+		return nil, e
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+		e := rows.Scan(
+			&webhook.CreatedAt,
+			pq.Array(&webhook.Events),
+			&webhook.ID,
+			&webhook.Secret,
+			&webhook.URL,
+		)
+		if e != nil {
+			return nil, e
+		}
+
+		webhooks = append(webhooks, &webhook)
+	}
+
+	if e := rows.Err(); e != nil {
+		return nil, e
+	}
+
+	return webhooks, nil
+}
+
+func (r WebhookRepository) SelectOne(id string) (*Webhook, error) {
+	query := `
+		SELECT created_at, events, id, secret, url
+		FROM webhooks
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var webhook Webhook
+	e := r.DB.QueryRowContext(ctx, query, id).Scan(
+		&webhook.CreatedAt,
+		pq.Array(&webhook.Events),
+		&webhook.ID,
+		&webhook.Secret,
+		&webhook.URL,
+	)
+	if e != nil {
+		switch {
+		case errors.Is(e, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, e
+		}
+	}
+
+	return &webhook, nil
+}
+
+func (r WebhookRepository) Delete(id string) error {
+	query := `
+		DELETE FROM webhooks
+		WHERE id=$1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, e := r.DB.ExecContext(ctx, query, id)
+	if e != nil {
+		return e
+	}
+
+	rowsAffected, e := result.RowsAffected()
+	if e != nil {
+		return e
+	}
+
+	if rowsAffected == 0 {
+		return ErrorRecordNotFound
+	}
+
+	return nil
+}
+
+func ValidateWebhook(v *validator.Validator, webhook *Webhook) {
+	u, e := url.Parse(webhook.URL)
+	v.Check(webhook.URL != "", "url", "is required")
+	v.Check(e == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", "must be an absolute http or https URL")
+	if e == nil {
+		// Hosts are resolved again when delivering, see PublicIP.
+		host := strings.ToLower(u.Hostname())
+		ip := net.ParseIP(host)
+		v.Check(host != "localhost" && !strings.HasSuffix(host, ".localhost") && (ip == nil || PublicIP(ip)), "url", "must not address a private, loopback or link-local host")
+	}
+
+	v.Check(len(webhook.Secret) >= 16, "secret", "must be at least 16 bytes long")
+	v.Check(len(webhook.Secret) <= 256, "secret", "must not be more than 256 bytes long")
+
+	for _, event := range webhook.Events {
+		v.Check(validator.In(event, WebhookEvents...), "events", "must only contain created, updated or deleted")
+	}
+	v.Check(validator.Unique(webhook.Events), "events", "must not contain duplicate values")
+}
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598, which
+// net.IP.IsPrivate does not cover.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// PublicIP reports whether ip may be the address of a webhook: webhooks must
+// not reach the private, loopback or link-local hosts of the network of the
+// dispatcher, such as the 169.254.169.254 metadata service of cloud providers.
+func PublicIP(ip net.IP) bool {
+	return !ip.IsUnspecified() &&
+		!ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!sharedAddressSpace.Contains(ip)
+}
+
+const (
+	WebhookDeliveryFailed    = "failed"
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+)
+
+type WebhookDelivery struct {
+	AttemptCount  int                      `json:"attempt_count"`
+	Attempts      []WebhookDeliveryAttempt `json:"attempts"`
+	CreatedAt     time.Time                `json:"created_at"`
+	Event         string                   `json:"event"`
+	ID            string                   `json:"id"`
+	NextAttemptAt time.Time                `json:"next_attempt_at"`
+	Payload       json.RawMessage          `json:"payload"`
+	Status        string                   `json:"status"`
+	WebhookID     string                   `json:"webhook_id"`
+}
+
+type WebhookDeliveryAttempt struct {
+	AttemptedAt    time.Time `json:"attempted_at"`
+	Duration       int       `json:"duration_ms"`
+	Error          string    `json:"error,omitempty"`
+	ResponseStatus int       `json:"response_status,omitempty"`
+}
+
+// Succeeded reports whether the receiver acknowledged the delivery.
+func (a WebhookDeliveryAttempt) Succeeded() bool {
+	return a.Error == "" && a.ResponseStatus >= 200 && a.ResponseStatus < 300
+}
+
+type WebhookDeliveryRepository struct {
+	DB *sql.DB
+}
+
+func (r WebhookDeliveryRepository) Insert(delivery *WebhookDelivery) error {
+	query := `
+		INSERT INTO webhook_deliveries (event, payload, webhook_id)
+		VALUES ($1, $2, $3)
+		RETURNING created_at, id, next_attempt_at, status`
+
+	args := []interface{}{delivery.Event, string(delivery.Payload), delivery.WebhookID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return r.DB.QueryRowContext(ctx, query, args...).Scan(
+		&delivery.CreatedAt,
+		&delivery.ID,
+		&delivery.NextAttemptAt,
+		&delivery.Status,
+	)
+}
+
+// Claim returns up to limit pending deliveries which are due and postpones
+// their next attempt by lease, so that concurrent dispatchers skip them while
+// they are being delivered.
+func (r WebhookDeliveryRepository) Claim(limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = NOW() + $1 * INTERVAL '1 second'
+		WHERE id IN (
+			SELECT id
+			FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING attempts, created_at, event, id, next_attempt_at, payload, status, webhook_id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, e := r.DB.QueryContext(ctx, query, int64(lease.Seconds()), limit)
+	if e != nil {
+		return nil, e
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		e := rows.Scan(
+			&delivery.AttemptCount,
+			&delivery.CreatedAt,
+			&delivery.Event,
+			&delivery.ID,
+			&delivery.NextAttemptAt,
+			(*[]byte)(&delivery.Payload),
+			&delivery.Status,
+			&delivery.WebhookID,
+		)
+		if e != nil {
+			return nil, e
+		}
+
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if e := rows.Err(); e != nil {
+		return nil, e
+	}
+
+	return deliveries, nil
+}
+
+// RecordAttempt stores an attempt and the resulting state of the delivery.
+func (r WebhookDeliveryRepository) RecordAttempt(delivery *WebhookDelivery, attempt WebhookDeliveryAttempt) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, e := r.DB.BeginTx(ctx, nil)
+	if e != nil {
+		return e
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO webhook_delivery_attempts (attempted_at, delivery_id, duration_ms, error, response_status)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	args := []interface{}{attempt.AttemptedAt, delivery.ID, attempt.Duration, attempt.Error, attempt.ResponseStatus}
+
+	_, e = tx.ExecContext(ctx, query, args...)
+	if e != nil {
+		return e
+	}
+
+	query = `
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1, next_attempt_at = $1, status = $2
+		WHERE id = $3`
+
+	_, e = tx.ExecContext(ctx, query, delivery.NextAttemptAt, delivery.Status, delivery.ID)
+	if e != nil {
+		return e
+	}
+
+	delivery.AttemptCount++
+	delivery.Attempts = append(delivery.Attempts, attempt)
+
+	return tx.Commit()
+}
+
+// SelectForWebhook returns the latest deliveries of a webhook along with their
+// attempts.
+func (r WebhookDeliveryRepository) SelectForWebhook(webhookID string, limit int) ([]*WebhookDelivery, error) {
+	query := `
+		SELECT d.attempts, d.created_at, d.event, d.id, d.next_attempt_at, d.payload, d.status, d.webhook_id,
+			COALESCE(json_agg(json_build_object(
+				'attempted_at', a.attempted_at,
+				'duration_ms', a.duration_ms,
+				'error', a.error,
+				'response_status', a.response_status
+			) ORDER BY a.attempted_at) FILTER (WHERE a.id IS NOT NULL), '[]')
+		FROM webhook_deliveries d
+		LEFT JOIN webhook_delivery_attempts a ON a.delivery_id = d.id
+		WHERE d.webhook_id = $1
+		GROUP BY d.id
+		ORDER BY d.created_at DESC
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, e := r.DB.QueryContext(ctx, query, webhookID, limit)
+	if e != nil {
+		return nil, e
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		var attempts []byte
+		e := rows.Scan(
+			&delivery.AttemptCount,
+			&delivery.CreatedAt,
+			&delivery.Event,
+			&delivery.ID,
+			&delivery.NextAttemptAt,
+			(*[]byte)(&delivery.Payload),
+			&delivery.Status,
+			&delivery.WebhookID,
+			&attempts,
+		)
+		if e != nil {
+			return nil, e
+		}
+
+		if e := json.Unmarshal(attempts, &delivery.Attempts); e != nil {
+			return nil, e
+		}
+
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if e := rows.Err(); e != nil {
+		return nil, e
+	}
+
+	return deliveries, nil
+}
+
+func (r WebhookDeliveryRepository) SelectOne(webhookID, id string) (*WebhookDelivery, error) {
+	query := `
+		SELECT attempts, created_at, event, id, next_attempt_at, payload, status, webhook_id
+		FROM webhook_deliveries
+		WHERE webhook_id = $1 AND id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var delivery WebhookDelivery
+	e := r.DB.QueryRowContext(ctx, query, webhookID, id).Scan(
+		&delivery.AttemptCount,
+		&delivery.CreatedAt,
+		&delivery.Event,
+		&delivery.ID,
+		&delivery.NextAttemptAt,
+		(*[]byte)(&delivery.Payload),
+		&delivery.Status,
+		&delivery.WebhookID,
+	)
+	if e != nil {
+		switch {
+		case errors.Is(e, sql.ErrNoRows):
+			return nil, ErrorRecordNotFound
+		default:
+			return nil, e
+		}
+	}
+
+	return &delivery, nil
+}
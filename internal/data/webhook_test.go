@@ -0,0 +1,62 @@
+package data
+
+import (
+	"net"
+	"testing"
+
+	"github.com/thomascastle/tarsk/internal/validator"
+)
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"0.0.0.0", false},
+		{"10.1.2.3", false},
+		{"100.64.0.1", false},
+		{"127.0.0.1", false},
+		{"169.254.169.254", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"224.0.0.1", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"fc00::1", false},
+		{"fe80::1", false},
+	}
+
+	for _, test := range tests {
+		if got := PublicIP(net.ParseIP(test.ip)); got != test.public {
+			t.Errorf("PublicIP(%s) = %v, want %v", test.ip, got, test.public)
+		}
+	}
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://example.com/hooks", true},
+		{"http://93.184.216.34:8080/hooks", true},
+		{"ftp://example.com/hooks", false},
+		{"/hooks", false},
+		{"http://localhost:8080/hooks", false},
+		{"http://api.LOCALHOST/hooks", false},
+		{"http://127.0.0.1/hooks", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://[::1]/hooks", false},
+	}
+
+	for _, test := range tests {
+		v := validator.New()
+		ValidateWebhook(v, &Webhook{Secret: "0123456789abcdef", URL: test.url})
+
+		if v.Valid() != test.valid {
+			t.Errorf("ValidateWebhook(%s) errors = %v, want valid %v", test.url, v.Errors, test.valid)
+		}
+	}
+}
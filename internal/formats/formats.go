@@ -0,0 +1,117 @@
+// Package formats converts tasks to and from the plain text formats people
+// keep their lists in: todo.txt and Markdown checklists. Both are line based:
+// each task is one line and lines which are not tasks are skipped.
+package formats
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/thomascastle/tarsk/internal/data"
+	"github.com/thomascastle/tarsk/internal/validator"
+)
+
+const dateLayout = "2006-01-02"
+
+var ErrorInvalidDate = errors.New("invalid date")
+
+// parseDate parses a YYYY-MM-DD date as midnight UTC.
+func parseDate(key, value string) (time.Time, error) {
+	t, e := time.Parse(dateLayout, value)
+	if e != nil {
+		return time.Time{}, fmt.Errorf("%w: %s:%s", ErrorInvalidDate, key, value)
+	}
+
+	return t, nil
+}
+
+func formatDate(t time.Time) string {
+	return t.UTC().Format(dateLayout)
+}
+
+// priorityOf maps todo.txt priorities onto data.Priority. Letters after C are
+// lower priorities than C, hence low.
+func priorityOf(letter byte) data.Priority {
+	switch {
+	case letter == 'A':
+		return data.PriorityHigh
+	case letter == 'B':
+		return data.PriorityMedium
+	case letter >= 'C' && letter <= 'Z':
+		return data.PriorityLow
+	default:
+		return data.PriorityNone
+	}
+}
+
+// letterOf is the reverse of priorityOf; it returns 0 for no priority.
+func letterOf(priority data.Priority) byte {
+	switch priority {
+	case data.PriorityHigh:
+		return 'A'
+	case data.PriorityMedium:
+		return 'B'
+	case data.PriorityLow:
+		return 'C'
+	default:
+		return 0
+	}
+}
+
+// isTag reports whether a word is a key:value tag of one of the given keys.
+func isTag(word string, keys ...string) bool {
+	key, value, found := strings.Cut(word, ":")
+
+	return found && value != "" && validator.In(key, keys...)
+}
+
+// escape protects the words of a description which the parser would take for
+// something else, such as a tag, by prepending a backslash, which unescape
+// removes. special reports whether a word, the first word of the description
+// or another one, needs protecting; a word which would need protecting once
+// stripped of its leading backslashes is escaped too, so that unescape can
+// tell the backslashes of the escape from those of the description.
+func escape(words []string, special func(word string, first bool) bool) []string {
+	escaped := make([]string, len(words))
+	for i, word := range words {
+		if special(strings.TrimLeft(word, `\`), i == 0) {
+			word = `\` + word
+		}
+		escaped[i] = word
+	}
+
+	return escaped
+}
+
+// unescape is the reverse of escape.
+func unescape(words []string, special func(word string, first bool) bool) []string {
+	unescaped := make([]string, len(words))
+	for i, word := range words {
+		if strings.HasPrefix(word, `\`) && special(strings.TrimLeft(word, `\`), i == 0) {
+			word = word[1:]
+		}
+		unescaped[i] = word
+	}
+
+	return unescaped
+}
+
+// tags removes the key:value tags of the given keys from the words of a
+// description and returns the remaining words along with the values.
+func tags(words []string, keys ...string) ([]string, map[string]string) {
+	values := make(map[string]string)
+	remaining := words[:0:0]
+
+	for _, word := range words {
+		if isTag(word, keys...) {
+			key, value, _ := strings.Cut(word, ":")
+			values[key] = value
+			continue
+		}
+		remaining = append(remaining, word)
+	}
+
+	return remaining, values
+}
@@ -0,0 +1,135 @@
+package formats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/thomascastle/tarsk/internal/data"
+	"github.com/thomascastle/tarsk/internal/validator"
+)
+
+var (
+	day1 = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	day5 = time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+)
+
+var roundTripTasks = []struct {
+	name string
+	task data.Task
+}{
+	{"description only", data.Task{Description: "Buy milk", Priority: data.PriorityNone}},
+	{"every field", data.Task{Description: "Call Mom +family @phone", DueAt: day5, Priority: data.PriorityHigh, StartedAt: day1}},
+	{"done with priority", data.Task{Description: "Call Mom", Done: true, DueAt: day5, Priority: data.PriorityMedium, StartedAt: day1, UpdatedAt: day5}},
+	{"done without dates", data.Task{Description: "Call Mom", Done: true, Priority: data.PriorityLow}},
+	{"done without start", data.Task{Description: "Call Mom", Done: true, Priority: data.PriorityNone, UpdatedAt: day5}},
+	{"due only", data.Task{Description: "Pay rent", DueAt: day5, Priority: data.PriorityNone}},
+	{"started only", data.Task{Description: "Pay rent", Priority: data.PriorityLow, StartedAt: day1}},
+	{"tags in description", data.Task{Description: "Ask about pri:B and due:friday start:monday priority:urgent", Priority: data.PriorityNone}},
+	{"trailing tag in description", data.Task{Description: "Reply to due:2024-02-01", DueAt: day5, Priority: data.PriorityNone}},
+	{"escaped tag in description", data.Task{Description: `Type \due:friday and \\pri:A`, Priority: data.PriorityNone}},
+	{"leading x", data.Task{Description: "x marks the spot", Priority: data.PriorityNone}},
+	{"leading priority", data.Task{Description: "(A) is the best grade", Priority: data.PriorityNone}},
+	{"leading date", data.Task{Description: "2024-03-01 retrospective", Priority: data.PriorityNone}},
+	{"leading date after start", data.Task{Description: "2024-03-01 retrospective", Priority: data.PriorityNone, StartedAt: day1}},
+	{"leading backslash", data.Task{Description: `\x and \(A) stay`, Priority: data.PriorityNone}},
+	{"checkbox in description", data.Task{Description: "- [ ] nested", Priority: data.PriorityNone}},
+}
+
+func TestRoundTrip(t *testing.T) {
+	formats := []struct {
+		name   string
+		format func(*data.Task) string
+		parse  func(string) (*data.Task, error)
+	}{
+		{"todo.txt", FormatTodoTxt, ParseTodoTxt},
+		{"markdown", FormatMarkdown, ParseMarkdown},
+	}
+
+	for _, format := range formats {
+		for _, test := range roundTripTasks {
+			t.Run(format.name+"/"+test.name, func(t *testing.T) {
+				line := format.format(&test.task)
+
+				got, e := format.parse(line)
+				if e != nil {
+					t.Fatalf("parsing %q: %v", line, e)
+				}
+				if got == nil {
+					t.Fatalf("parsing %q: no task", line)
+				}
+
+				assertTask(t, line, got, &test.task)
+			})
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		parse func(string) (*data.Task, error)
+		line  string
+		want  data.Task
+	}{
+		{"todo.txt priority", ParseTodoTxt, "(A) Call Mom", data.Task{Description: "Call Mom", Priority: data.PriorityHigh}},
+		{"todo.txt every field", ParseTodoTxt, "(B) 2024-01-01 Call Mom +family due:2024-01-05", data.Task{Description: "Call Mom +family", DueAt: day5, Priority: data.PriorityMedium, StartedAt: day1}},
+		{"todo.txt done", ParseTodoTxt, "x 2024-01-04 2024-01-01 Call Mom pri:A", data.Task{Description: "Call Mom", Done: true, Priority: data.PriorityHigh, StartedAt: day1}},
+		{"todo.txt escaped", ParseTodoTxt, `\x \due:friday`, data.Task{Description: "x due:friday", Priority: data.PriorityNone}},
+		{"markdown plain", ParseMarkdown, "- [ ] Buy milk", data.Task{Description: "Buy milk", Priority: data.PriorityNone}},
+		{"markdown every field", ParseMarkdown, "  * [X] Call Mom due:2024-01-05 start:2024-01-01 priority:high", data.Task{Description: "Call Mom", Done: true, DueAt: day5, Priority: data.PriorityHigh, StartedAt: day1}},
+		{"markdown escaped", ParseMarkdown, `- [ ] Ask \priority:urgent`, data.Task{Description: "Ask priority:urgent", Priority: data.PriorityNone}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, e := test.parse(test.line)
+			if e != nil {
+				t.Fatalf("parsing %q: %v", test.line, e)
+			}
+			if got == nil {
+				t.Fatalf("parsing %q: no task", test.line)
+			}
+
+			assertTask(t, test.line, got, &test.want)
+		})
+	}
+}
+
+func TestParseSkipsLines(t *testing.T) {
+	for _, line := range []string{"", "   "} {
+		if task, e := ParseTodoTxt(line); task != nil || e != nil {
+			t.Errorf("ParseTodoTxt(%q) = %v, %v, want nil, nil", line, task, e)
+		}
+	}
+
+	for _, line := range []string{"", "# Tasks", "- Buy milk", "- [?] Buy milk"} {
+		if task, e := ParseMarkdown(line); task != nil || e != nil {
+			t.Errorf("ParseMarkdown(%q) = %v, %v, want nil, nil", line, task, e)
+		}
+	}
+}
+
+func assertTask(t *testing.T, line string, got, want *data.Task) {
+	t.Helper()
+
+	if got.Description != want.Description {
+		t.Errorf("%q: description = %q, want %q", line, got.Description, want.Description)
+	}
+	if got.Done != want.Done {
+		t.Errorf("%q: done = %v, want %v", line, got.Done, want.Done)
+	}
+	if !got.DueAt.Equal(want.DueAt) {
+		t.Errorf("%q: due_at = %v, want %v", line, got.DueAt, want.DueAt)
+	}
+	if got.Priority != want.Priority {
+		t.Errorf("%q: priority = %q, want %q", line, got.Priority, want.Priority)
+	}
+	if !got.StartedAt.Equal(want.StartedAt) {
+		t.Errorf("%q: started_at = %v, want %v", line, got.StartedAt, want.StartedAt)
+	}
+
+	v := validator.New()
+	if data.ValidateTask(v, got); !v.Valid() {
+		t.Errorf("%q: invalid task: %v", line, v.Errors)
+	}
+}
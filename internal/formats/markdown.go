@@ -0,0 +1,90 @@
+package formats
+
+import (
+	"strings"
+
+	"github.com/thomascastle/tarsk/internal/data"
+)
+
+// ParseMarkdown parses a GitHub-style checklist item such as
+//
+//   - [x] Call Mom due:2024-01-05 start:2024-01-01 priority:high
+//
+// A checked box sets Done and the due, start and priority tags set DueAt,
+// StartedAt and Priority. Items may be indented and use -, * or + bullets. It
+// returns nil for a line which is not a checklist item, such as a heading. A
+// word of the description which reads like one of the tags is written with a
+// leading backslash, as in \due:friday.
+func ParseMarkdown(line string) (*data.Task, error) {
+	line = strings.TrimSpace(line)
+	if len(line) < 6 || !strings.ContainsRune("-*+", rune(line[0])) || line[1] != ' ' || line[2] != '[' || line[4] != ']' {
+		return nil, nil
+	}
+
+	task := &data.Task{Priority: data.PriorityNone}
+
+	switch line[3] {
+	case ' ':
+	case 'x', 'X':
+		task.Done = true
+	default:
+		return nil, nil
+	}
+
+	words, values := tags(strings.Fields(line[5:]), markdownTags...)
+
+	if value, found := values["due"]; found {
+		t, e := parseDate("due", value)
+		if e != nil {
+			return nil, e
+		}
+		task.DueAt = t
+	}
+
+	if value, found := values["priority"]; found {
+		task.Priority = data.Priority(value)
+	}
+
+	if value, found := values["start"]; found {
+		t, e := parseDate("start", value)
+		if e != nil {
+			return nil, e
+		}
+		task.StartedAt = t
+	}
+
+	task.Description = strings.Join(unescape(words, isMarkdownTag), " ")
+
+	return task, nil
+}
+
+// FormatMarkdown formats a task as a checklist item, the reverse of
+// ParseMarkdown.
+func FormatMarkdown(task *data.Task) string {
+	words := []string{"-", "[ ]"}
+	if task.Done {
+		words[1] = "[x]"
+	}
+
+	words = append(words, escape(strings.Fields(task.Description), isMarkdownTag)...)
+
+	if !task.DueAt.IsZero() {
+		words = append(words, "due:"+formatDate(task.DueAt))
+	}
+
+	if !task.StartedAt.IsZero() {
+		words = append(words, "start:"+formatDate(task.StartedAt))
+	}
+
+	if task.Priority != "" && task.Priority != data.PriorityNone {
+		words = append(words, "priority:"+string(task.Priority))
+	}
+
+	return strings.Join(words, " ")
+}
+
+var markdownTags = []string{"due", "priority", "start"}
+
+func isMarkdownTag(word string, _ bool) bool {
+	return isTag(word, markdownTags...)
+}
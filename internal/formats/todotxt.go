@@ -0,0 +1,123 @@
+package formats
+
+import (
+	"strings"
+
+	"github.com/thomascastle/tarsk/internal/data"
+)
+
+// ParseTodoTxt parses a todo.txt line such as
+//
+//	(A) 2024-01-01 Call Mom +family due:2024-01-05
+//	x 2024-01-04 2024-01-01 Call Mom +family due:2024-01-05 pri:A
+//
+// The x marker sets Done, the priority letter sets Priority, the creation date
+// sets StartedAt and the due tag sets DueAt. Completed tasks carry their
+// priority in a pri tag, as todo.txt drops the leading one on completion.
+// Projects and contexts stay in the description. A word of the description
+// which reads like a tag, or a first word which reads like the x marker, a
+// priority or a date, is written with a leading backslash, as in
+// \(A) or \due:friday. It returns nil for a blank line.
+func ParseTodoTxt(line string) (*data.Task, error) {
+	words := strings.Fields(line)
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	task := &data.Task{Priority: data.PriorityNone}
+
+	if words[0] == "x" {
+		task.Done = true
+		words = words[1:]
+
+		// A completion date comes first, followed by the creation date.
+		if len(words) > 0 && isDate(words[0]) {
+			words = words[1:]
+		}
+	} else if isPriority(words[0]) {
+		task.Priority = priorityOf(words[0][1])
+		words = words[1:]
+	}
+
+	if len(words) > 0 && isDate(words[0]) {
+		t, e := parseDate("created", words[0])
+		if e != nil {
+			return nil, e
+		}
+		task.StartedAt = t
+		words = words[1:]
+	}
+
+	words, values := tags(words, todoTxtTags...)
+
+	if value, found := values["due"]; found {
+		t, e := parseDate("due", value)
+		if e != nil {
+			return nil, e
+		}
+		task.DueAt = t
+	}
+
+	if value, found := values["pri"]; found && len(value) == 1 {
+		task.Priority = priorityOf(value[0])
+	}
+
+	task.Description = strings.Join(unescape(words, isTodoTxtSpecial), " ")
+
+	return task, nil
+}
+
+// FormatTodoTxt formats a task as a todo.txt line, the reverse of
+// ParseTodoTxt. The date a task was last updated stands for the completion
+// date of done tasks.
+func FormatTodoTxt(task *data.Task) string {
+	var words []string
+
+	letter := letterOf(task.Priority)
+
+	if task.Done {
+		words = append(words, "x")
+
+		completed := task.UpdatedAt
+		if completed.IsZero() {
+			completed = task.StartedAt
+		}
+		if !completed.IsZero() {
+			words = append(words, formatDate(completed))
+		}
+	} else if letter != 0 {
+		words = append(words, "("+string(letter)+")")
+	}
+
+	if !task.StartedAt.IsZero() {
+		words = append(words, formatDate(task.StartedAt))
+	}
+
+	words = append(words, escape(strings.Fields(task.Description), isTodoTxtSpecial)...)
+
+	if !task.DueAt.IsZero() {
+		words = append(words, "due:"+formatDate(task.DueAt))
+	}
+
+	if task.Done && letter != 0 {
+		words = append(words, "pri:"+string(letter))
+	}
+
+	return strings.Join(words, " ")
+}
+
+func isDate(word string) bool {
+	return len(word) == len(dateLayout) && word[4] == '-' && word[7] == '-'
+}
+
+func isPriority(word string) bool {
+	return len(word) == 3 && word[0] == '(' && word[2] == ')' && word[1] >= 'A' && word[1] <= 'Z'
+}
+
+var todoTxtTags = []string{"due", "pri"}
+
+// isTodoTxtSpecial reports whether a word of a description would be parsed as
+// a tag or, as the first word, as a marker preceding the description.
+func isTodoTxtSpecial(word string, first bool) bool {
+	return isTag(word, todoTxtTags...) || first && (word == "x" || isPriority(word) || isDate(word))
+}
@@ -0,0 +1,316 @@
+// Package jsonpatch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to values decoded by encoding/json.
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrorInvalidPatch = errors.New("invalid patch")
+	ErrorTestFailed   = errors.New("test operation failed")
+)
+
+// Merge applies an RFC 7396 merge patch to doc. A null member in the patch
+// removes the member from doc.
+func Merge(doc, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	docObject, ok := doc.(map[string]interface{})
+	if !ok {
+		docObject = make(map[string]interface{})
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(docObject, key)
+			continue
+		}
+		docObject[key] = Merge(docObject[key], value)
+	}
+
+	return docObject
+}
+
+// Operation is a single RFC 6902 operation.
+type Operation struct {
+	From  string          `json:"from"`
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+func (o Operation) value() (interface{}, error) {
+	if len(o.Value) == 0 {
+		return nil, fmt.Errorf("%w: %s operation requires a value", ErrorInvalidPatch, o.Op)
+	}
+
+	var value interface{}
+	if e := json.Unmarshal(o.Value, &value); e != nil {
+		return nil, fmt.Errorf("%w: %v", ErrorInvalidPatch, e)
+	}
+
+	return value, nil
+}
+
+// Apply applies the RFC 6902 operations to doc in order. Either every
+// operation succeeds or an error is returned; doc itself is left untouched.
+func Apply(doc interface{}, operations []Operation) (interface{}, error) {
+	doc = clone(doc)
+
+	for _, operation := range operations {
+		path, e := parsePointer(operation.Path)
+		if e != nil {
+			return nil, e
+		}
+
+		switch operation.Op {
+		case "add":
+			value, e := operation.value()
+			if e != nil {
+				return nil, e
+			}
+			doc, e = add(doc, path, value)
+			if e != nil {
+				return nil, e
+			}
+		case "remove":
+			doc, _, e = remove(doc, path)
+			if e != nil {
+				return nil, e
+			}
+		case "replace":
+			value, e := operation.value()
+			if e != nil {
+				return nil, e
+			}
+			doc, _, e = remove(doc, path)
+			if e != nil {
+				return nil, e
+			}
+			doc, e = add(doc, path, value)
+			if e != nil {
+				return nil, e
+			}
+		case "move", "copy":
+			from, e := parsePointer(operation.From)
+			if e != nil {
+				return nil, e
+			}
+			var value interface{}
+			if operation.Op == "move" {
+				if isPrefix(from, path) && len(from) < len(path) {
+					return nil, fmt.Errorf("%w: cannot move %q into one of its children", ErrorInvalidPatch, operation.From)
+				}
+				doc, value, e = remove(doc, from)
+			} else {
+				value, e = get(doc, from)
+				value = clone(value)
+			}
+			if e != nil {
+				return nil, e
+			}
+			doc, e = add(doc, path, value)
+			if e != nil {
+				return nil, e
+			}
+		case "test":
+			expected, e := operation.value()
+			if e != nil {
+				return nil, e
+			}
+			actual, e := get(doc, path)
+			if e != nil {
+				return nil, fmt.Errorf("%w: %v", ErrorTestFailed, e)
+			}
+			if !reflect.DeepEqual(actual, expected) {
+				return nil, fmt.Errorf("%w: value at %q differs", ErrorTestFailed, operation.Path)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown operation %q", ErrorInvalidPatch, operation.Op)
+		}
+	}
+
+	return doc, nil
+}
+
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: path %q must start with /", ErrorInvalidPatch, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, found := node[token]
+			if !found {
+				return nil, fmt.Errorf("%w: member %q does not exist", ErrorInvalidPatch, token)
+			}
+			doc = value
+		case []interface{}:
+			i, e := index(token, len(node)-1)
+			if e != nil {
+				return nil, e
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("%w: %q cannot be traversed", ErrorInvalidPatch, token)
+		}
+	}
+
+	return doc, nil
+}
+
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, e := get(doc, path[:len(path)-1])
+	if e != nil {
+		return nil, e
+	}
+	token := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[token] = value
+		return doc, nil
+	case []interface{}:
+		i := len(node)
+		if token != "-" {
+			i, e = index(token, len(node))
+			if e != nil {
+				return nil, e
+			}
+		}
+		node = append(node, nil)
+		copy(node[i+1:], node[i:])
+		node[i] = value
+		return replaceParent(doc, path[:len(path)-1], node)
+	default:
+		return nil, fmt.Errorf("%w: cannot add %q", ErrorInvalidPatch, token)
+	}
+}
+
+func remove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+
+	parent, e := get(doc, path[:len(path)-1])
+	if e != nil {
+		return nil, nil, e
+	}
+	token := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		value, found := node[token]
+		if !found {
+			return nil, nil, fmt.Errorf("%w: member %q does not exist", ErrorInvalidPatch, token)
+		}
+		delete(node, token)
+		return doc, value, nil
+	case []interface{}:
+		i, e := index(token, len(node)-1)
+		if e != nil {
+			return nil, nil, e
+		}
+		value := node[i]
+		node = append(node[:i:i], node[i+1:]...)
+		doc, e = replaceParent(doc, path[:len(path)-1], node)
+		return doc, value, e
+	default:
+		return nil, nil, fmt.Errorf("%w: cannot remove %q", ErrorInvalidPatch, token)
+	}
+}
+
+// replaceParent stores an array which was reallocated by add or remove back
+// into its own parent.
+func replaceParent(doc interface{}, path []string, array []interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return array, nil
+	}
+
+	grandparent, e := get(doc, path[:len(path)-1])
+	if e != nil {
+		return nil, e
+	}
+	token := path[len(path)-1]
+
+	switch node := grandparent.(type) {
+	case map[string]interface{}:
+		node[token] = array
+	case []interface{}:
+		i, e := index(token, len(node)-1)
+		if e != nil {
+			return nil, e
+		}
+		node[i] = array
+	}
+
+	return doc, nil
+}
+
+func index(token string, max int) (int, error) {
+	i, e := strconv.Atoi(token)
+	if e != nil || i < 0 || i > max || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrorInvalidPatch, token)
+	}
+
+	return i, nil
+}
+
+func clone(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			c[key] = clone(value)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, value := range v {
+			c[i] = clone(value)
+		}
+		return c
+	default:
+		return v
+	}
+}
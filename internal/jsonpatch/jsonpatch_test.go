@@ -0,0 +1,129 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func decode(t *testing.T, s string) interface{} {
+	t.Helper()
+
+	var value interface{}
+	if e := json.Unmarshal([]byte(s), &value); e != nil {
+		t.Fatalf("decoding %s: %v", s, e)
+	}
+
+	return value
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"replace member", `{"a": "b"}`, `{"a": "c"}`, `{"a": "c"}`},
+		{"add member", `{"a": "b"}`, `{"b": "c"}`, `{"a": "b", "b": "c"}`},
+		{"null removes member", `{"a": "b", "b": "c"}`, `{"a": null}`, `{"b": "c"}`},
+		{"nested", `{"a": {"b": "c", "d": "e"}}`, `{"a": {"d": null, "f": "g"}}`, `{"a": {"b": "c", "f": "g"}}`},
+		{"array replaced whole", `{"a": [1, 2]}`, `{"a": [3]}`, `{"a": [3]}`},
+		{"non-object patch replaces doc", `{"a": "b"}`, `["c"]`, `["c"]`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Merge(decode(t, test.doc), decode(t, test.patch))
+
+			if want := decode(t, test.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("Merge(%s, %s) = %v, want %v", test.doc, test.patch, got, want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+		e     error
+	}{
+		{"add member", `{"a": 1}`, `[{"op": "add", "path": "/b", "value": 2}]`, `{"a": 1, "b": 2}`, nil},
+		{"add replaces member", `{"a": 1}`, `[{"op": "add", "path": "/a", "value": 2}]`, `{"a": 2}`, nil},
+		{"add inserts into array", `{"a": [1, 3]}`, `[{"op": "add", "path": "/a/1", "value": 2}]`, `{"a": [1, 2, 3]}`, nil},
+		{"add appends with -", `{"a": [1]}`, `[{"op": "add", "path": "/a/-", "value": 2}]`, `{"a": [1, 2]}`, nil},
+		{"add at array length", `{"a": [1]}`, `[{"op": "add", "path": "/a/1", "value": 2}]`, `{"a": [1, 2]}`, nil},
+		{"add past array end", `{"a": [1]}`, `[{"op": "add", "path": "/a/2", "value": 2}]`, ``, ErrorInvalidPatch},
+		{"add to missing parent", `{}`, `[{"op": "add", "path": "/a/b", "value": 1}]`, ``, ErrorInvalidPatch},
+		{"add whole document", `{"a": 1}`, `[{"op": "add", "path": "", "value": [1]}]`, `[1]`, nil},
+		{"add without value", `{}`, `[{"op": "add", "path": "/a"}]`, ``, ErrorInvalidPatch},
+		{"remove member", `{"a": 1, "b": 2}`, `[{"op": "remove", "path": "/a"}]`, `{"b": 2}`, nil},
+		{"remove array element", `{"a": [1, 2, 3]}`, `[{"op": "remove", "path": "/a/1"}]`, `{"a": [1, 3]}`, nil},
+		{"remove missing member", `{"a": 1}`, `[{"op": "remove", "path": "/b"}]`, ``, ErrorInvalidPatch},
+		{"remove with -", `{"a": [1]}`, `[{"op": "remove", "path": "/a/-"}]`, ``, ErrorInvalidPatch},
+		{"replace member", `{"a": 1}`, `[{"op": "replace", "path": "/a", "value": null}]`, `{"a": null}`, nil},
+		{"replace array element", `[1, 2, 3]`, `[{"op": "replace", "path": "/1", "value": 4}]`, `[1, 4, 3]`, nil},
+		{"replace missing member", `{}`, `[{"op": "replace", "path": "/a", "value": 1}]`, ``, ErrorInvalidPatch},
+		{"move member", `{"a": {"b": 1}, "c": {}}`, `[{"op": "move", "from": "/a/b", "path": "/c/d"}]`, `{"a": {}, "c": {"d": 1}}`, nil},
+		{"move array element", `[1, 2, 3]`, `[{"op": "move", "from": "/0", "path": "/-"}]`, `[2, 3, 1]`, nil},
+		{"move into child", `{"a": {"b": {}}}`, `[{"op": "move", "from": "/a", "path": "/a/b/c"}]`, ``, ErrorInvalidPatch},
+		{"copy member", `{"a": {"b": 1}}`, `[{"op": "copy", "from": "/a", "path": "/c"}]`, `{"a": {"b": 1}, "c": {"b": 1}}`, nil},
+		{"copy missing member", `{}`, `[{"op": "copy", "from": "/a", "path": "/b"}]`, ``, ErrorInvalidPatch},
+		{"test passes", `{"a": [1, {"b": "c"}]}`, `[{"op": "test", "path": "/a", "value": [1, {"b": "c"}]}]`, `{"a": [1, {"b": "c"}]}`, nil},
+		{"test fails", `{"a": 1}`, `[{"op": "test", "path": "/a", "value": 2}]`, ``, ErrorTestFailed},
+		{"test missing member", `{}`, `[{"op": "test", "path": "/a", "value": 1}]`, ``, ErrorTestFailed},
+		{"test then replace", `{"a": 1}`, `[{"op": "test", "path": "/a", "value": 1}, {"op": "replace", "path": "/a", "value": 2}]`, `{"a": 2}`, nil},
+		{"failed test aborts patch", `{"a": 1}`, `[{"op": "replace", "path": "/a", "value": 2}, {"op": "test", "path": "/a", "value": 1}]`, ``, ErrorTestFailed},
+		{"~1 escapes /", `{"a/b": 1}`, `[{"op": "replace", "path": "/a~1b", "value": 2}]`, `{"a/b": 2}`, nil},
+		{"~0 escapes ~", `{"a~b": 1}`, `[{"op": "remove", "path": "/a~0b"}]`, `{}`, nil},
+		{"~01 is ~1", `{"~1": 1}`, `[{"op": "test", "path": "/~01", "value": 1}]`, `{"~1": 1}`, nil},
+		{"leading zero index", `[1, 2]`, `[{"op": "remove", "path": "/01"}]`, ``, ErrorInvalidPatch},
+		{"path without /", `{"a": 1}`, `[{"op": "remove", "path": "a"}]`, ``, ErrorInvalidPatch},
+		{"unknown operation", `{}`, `[{"op": "merge", "path": "/a"}]`, ``, ErrorInvalidPatch},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var operations []Operation
+			if e := json.Unmarshal([]byte(test.patch), &operations); e != nil {
+				t.Fatalf("decoding %s: %v", test.patch, e)
+			}
+
+			got, e := Apply(decode(t, test.doc), operations)
+			if test.e != nil {
+				if !errors.Is(e, test.e) {
+					t.Errorf("Apply(%s, %s) error = %v, want %v", test.doc, test.patch, e, test.e)
+				}
+				return
+			}
+			if e != nil {
+				t.Fatalf("Apply(%s, %s) error = %v", test.doc, test.patch, e)
+			}
+
+			if want := decode(t, test.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("Apply(%s, %s) = %v, want %v", test.doc, test.patch, got, want)
+			}
+		})
+	}
+}
+
+func TestApplyLeavesDocUntouched(t *testing.T) {
+	doc := decode(t, `{"a": [1, 2], "b": {"c": 1}}`)
+	operations := []Operation{
+		{Op: "remove", Path: "/a/0"},
+		{Op: "add", Path: "/b/d", Value: json.RawMessage(`2`)},
+		{Op: "test", Path: "/b/c", Value: json.RawMessage(`3`)},
+	}
+
+	if _, e := Apply(doc, operations); !errors.Is(e, ErrorTestFailed) {
+		t.Fatalf("Apply() error = %v, want %v", e, ErrorTestFailed)
+	}
+
+	if want := decode(t, `{"a": [1, 2], "b": {"c": 1}}`); !reflect.DeepEqual(doc, want) {
+		t.Errorf("doc = %v, want %v", doc, want)
+	}
+}
@@ -2,15 +2,30 @@ package messaging
 
 import (
 	"context"
+	"crypto/tls"
 
 	"github.com/go-redis/redis/v8"
 )
 
-func NewClient() (*redis.Client, error) {
-	r_client := redis.NewClient(&redis.Options{
-		Addr: "localhost:6379",
-		DB:   0,
-	})
+// Config locates and authenticates against a Redis server.
+type Config struct {
+	Addr     string
+	DB       int
+	Password string
+	TLS      bool
+}
+
+func NewClient(config Config) (*redis.Client, error) {
+	options := &redis.Options{
+		Addr:     config.Addr,
+		DB:       config.DB,
+		Password: config.Password,
+	}
+	if config.TLS {
+		options.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	r_client := redis.NewClient(options)
 
 	if _, e := r_client.Ping(context.Background()).Result(); e != nil {
 		return nil, e
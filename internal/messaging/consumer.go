@@ -0,0 +1,95 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// StreamConsumer reads the event stream as a member of a consumer group:
+// every event is read by a single member of the group, and is read again
+// until it is acknowledged with Ack, even across restarts.
+type StreamConsumer struct {
+	client  *redis.Client
+	group   string
+	name    string
+	pending bool
+}
+
+// NewStreamConsumer returns the consumer name of group, creating the group if
+// it does not exist yet. A new group starts with the events published after
+// its creation.
+func NewStreamConsumer(ctx context.Context, client *redis.Client, group, name string) (*StreamConsumer, error) {
+	e := client.XGroupCreateMkStream(ctx, EventStream, group, "$").Err()
+	if e != nil && !strings.HasPrefix(e.Error(), "BUSYGROUP") {
+		return nil, e
+	}
+
+	return &StreamConsumer{client: client, group: group, name: name, pending: true}, nil
+}
+
+// Read returns the events which were read but not acknowledged by this
+// consumer, if any, or else the next events of the stream, waiting up to
+// timeout for one to be published. No events and no error are returned when
+// the timeout expires.
+func (c *StreamConsumer) Read(ctx context.Context, timeout time.Duration) ([]Event, error) {
+	if c.pending {
+		events, e := c.read(ctx, "0", -1)
+		if e != nil || len(events) > 0 {
+			return events, e
+		}
+		c.pending = false
+	}
+
+	return c.read(ctx, ">", timeout)
+}
+
+// Retry makes the next Read return the events which were not acknowledged,
+// such as those whose handling failed.
+func (c *StreamConsumer) Retry() {
+	c.pending = true
+}
+
+func (c *StreamConsumer) read(ctx context.Context, id string, timeout time.Duration) ([]Event, error) {
+	streams, e := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    c.group,
+		Consumer: c.name,
+		Streams:  []string{EventStream, id},
+		Count:    100,
+		Block:    timeout,
+	}).Result()
+	if e != nil {
+		if errors.Is(e, redis.Nil) {
+			return nil, nil
+		}
+		return nil, e
+	}
+
+	var events []Event
+	for _, stream := range streams {
+		// Pending entries which were trimmed from the stream meanwhile are
+		// read without values, and cannot be handled anymore.
+		messages := stream.Messages[:0:0]
+		for _, message := range stream.Messages {
+			if len(message.Values) == 0 {
+				if e := c.Ack(ctx, message.ID); e != nil {
+					return nil, e
+				}
+				continue
+			}
+			messages = append(messages, message)
+		}
+
+		events = append(events, eventsOf(messages)...)
+	}
+
+	return events, nil
+}
+
+// Ack acknowledges the events with the given IDs, which are not read again.
+func (c *StreamConsumer) Ack(ctx context.Context, ids ...string) error {
+	return c.client.XAck(ctx, EventStream, c.group, ids...).Err()
+}
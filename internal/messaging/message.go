@@ -0,0 +1,47 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+)
+
+type contextKey string
+
+const requestIDContextKey = contextKey("request_id")
+
+// WithRequestID returns a copy of ctx carrying the ID of the request which
+// caused the events published with it.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "" if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+
+	return id
+}
+
+// Message is what is published on the tasks.event.* channels: the event along
+// with the ID of the request which caused it, so that consumers can correlate
+// their logs with the API's, and the traceparent of the span which published
+// it, so that consumers can continue the trace.
+type Message struct {
+	Data        json.RawMessage `json:"data"`
+	RequestID   string          `json:"request_id,omitempty"`
+	Traceparent string          `json:"traceparent,omitempty"`
+}
+
+// DecodeMessage decodes the payload of a published message. A payload
+// published before events carried a request ID is the event itself.
+//
+// Consumers which predate Message cannot decode it, so they must be upgraded
+// before the publishers: upgraded consumers read both payloads.
+func DecodeMessage(payload string) Message {
+	var message Message
+	if e := json.Unmarshal([]byte(payload), &message); e != nil || len(message.Data) == 0 {
+		return Message{Data: json.RawMessage(payload)}
+	}
+
+	return message
+}
@@ -4,18 +4,36 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"strings"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/thomascastle/tarsk/internal/data"
+	"github.com/thomascastle/tarsk/internal/metrics"
+	"github.com/thomascastle/tarsk/internal/tracing"
+)
+
+// EventStream is the Redis stream every published event is also appended to,
+// so that consumers can read past events. Only the latest events are kept.
+// Entries hold the event as is, its request ID and traceparent being fields of
+// their own.
+const (
+	EventStream       = "tasks.events"
+	eventStreamMaxLen = 10_000
 )
 
 type TaskMessageBrokerage struct {
-	client *redis.Client
+	client    *redis.Client
+	failed    *metrics.Counter
+	published *metrics.Counter
 }
 
-func NewTaskMessageBrokerage(client *redis.Client) *TaskMessageBrokerage {
+func NewTaskMessageBrokerage(client *redis.Client, registry *metrics.Registry) *TaskMessageBrokerage {
 	return &TaskMessageBrokerage{
-		client: client,
+		client:    client,
+		failed:    registry.Counter("tarsk_events_publish_failures_total", "Task events which could not be published.", "event"),
+		published: registry.Counter("tarsk_events_published_total", "Task events published.", "event"),
 	}
 }
 
@@ -31,16 +49,137 @@ func (b *TaskMessageBrokerage) Updated(ctx context.Context, task *data.Task) err
 	return b.publish(ctx, "tasks.event.updated", task)
 }
 
-func (b *TaskMessageBrokerage) publish(ctx context.Context, channel string, event interface{}) error {
+// publish publishes an event along with the request ID carried by ctx, see
+// WithRequestID, and the span context of its publication.
+func (b *TaskMessageBrokerage) publish(ctx context.Context, channel string, event interface{}) (e error) {
+	ctx, span := tracing.Start(ctx, "redis publish "+channel)
+	defer func() {
+		span.RecordError(e)
+		span.End()
+	}()
+
 	var buf bytes.Buffer
 	if e := json.NewEncoder(&buf).Encode(event); e != nil {
 		return e
 	}
 
-	result := b.client.Publish(ctx, channel, buf.Bytes())
-	if e := result.Err(); e != nil {
+	request_id := RequestID(ctx)
+
+	message := Message{
+		Data:        bytes.TrimSpace(buf.Bytes()),
+		RequestID:   request_id,
+		Traceparent: tracing.Traceparent(ctx),
+	}
+
+	message_JSON, e := json.Marshal(message)
+	if e != nil {
 		return e
 	}
 
+	pipe := b.client.TxPipeline()
+	pipe.Publish(ctx, channel, message_JSON)
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: EventStream,
+		MaxLen: eventStreamMaxLen,
+		Approx: true,
+		Values: map[string]interface{}{"channel": channel, "payload": buf.String(), "request_id": request_id, "traceparent": message.Traceparent},
+	})
+
+	event_type := strings.TrimPrefix(channel, "tasks.event.")
+
+	if _, e := pipe.Exec(ctx); e != nil {
+		b.failed.Inc(event_type)
+		return e
+	}
+
+	b.published.Inc(event_type)
+
 	return nil
 }
+
+// Event is a task event read back from the event stream.
+type Event struct {
+	ID          string
+	Payload     string
+	RequestID   string
+	Traceparent string
+	Type        string
+}
+
+// LastEventID returns the ID of the latest event in the stream, or "0-0" when
+// the stream is empty.
+func (b *TaskMessageBrokerage) LastEventID(ctx context.Context) (string, error) {
+	messages, e := b.client.XRevRangeN(ctx, EventStream, "+", "-", 1).Result()
+	if e != nil {
+		return "", e
+	}
+
+	if len(messages) == 0 {
+		return "0-0", nil
+	}
+
+	return messages[0].ID, nil
+}
+
+// ReadEvents returns the events following the one with the given ID, waiting
+// up to timeout for one to be published. No events and no error are returned
+// when the timeout expires.
+func (b *TaskMessageBrokerage) ReadEvents(ctx context.Context, after string, timeout time.Duration) ([]Event, error) {
+	streams, e := b.client.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{EventStream, after},
+		Count:   100,
+		Block:   timeout,
+	}).Result()
+	if e != nil {
+		if errors.Is(e, redis.Nil) {
+			return nil, nil
+		}
+		return nil, e
+	}
+
+	var events []Event
+	for _, stream := range streams {
+		events = append(events, eventsOf(stream.Messages)...)
+	}
+
+	return events, nil
+}
+
+// EventsAfter returns up to count of the events following the one with the
+// given ID, without waiting for new ones to be published.
+func (b *TaskMessageBrokerage) EventsAfter(ctx context.Context, after string, count int64) ([]Event, error) {
+	// The range includes the event with the given ID, if it is still kept.
+	messages, e := b.client.XRangeN(ctx, EventStream, after, "+", count+1).Result()
+	if e != nil {
+		return nil, e
+	}
+
+	if len(messages) > 0 && messages[0].ID == after {
+		messages = messages[1:]
+	}
+	if int64(len(messages)) > count {
+		messages = messages[:count]
+	}
+
+	return eventsOf(messages), nil
+}
+
+func eventsOf(messages []redis.XMessage) []Event {
+	events := make([]Event, 0, len(messages))
+	for _, message := range messages {
+		channel, _ := message.Values["channel"].(string)
+		payload, _ := message.Values["payload"].(string)
+		request_id, _ := message.Values["request_id"].(string)
+		traceparent, _ := message.Values["traceparent"].(string)
+
+		events = append(events, Event{
+			ID:          message.ID,
+			Payload:     payload,
+			RequestID:   request_id,
+			Traceparent: traceparent,
+			Type:        strings.TrimPrefix(channel, "tasks.event."),
+		})
+	}
+
+	return events
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const golden = `# HELP test_requests_total Requests.\nServed by \\ route.
+# TYPE test_requests_total counter
+test_requests_total{method="GET",route="/a\"b\\c\n"} 1
+test_requests_total{method="GET",route="/v1/tasks"} 2.5
+# HELP test_rejected_total Rejected requests.
+# TYPE test_rejected_total counter
+test_rejected_total 0
+# HELP test_duration_seconds Latency.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{method="GET",le="0.1"} 1
+test_duration_seconds_bucket{method="GET",le="1"} 2
+test_duration_seconds_bucket{method="GET",le="+Inf"} 3
+test_duration_seconds_sum{method="GET"} 2.5625
+test_duration_seconds_count{method="GET"} 3
+test_duration_seconds_bucket{method="POST",le="0.1"} 0
+test_duration_seconds_bucket{method="POST",le="1"} 1
+test_duration_seconds_bucket{method="POST",le="+Inf"} 1
+test_duration_seconds_sum{method="POST"} 1
+test_duration_seconds_count{method="POST"} 1
+# HELP test_connections_open Open connections.
+# TYPE test_connections_open gauge
+test_connections_open 3
+# HELP test_waits_total Waits.
+# TYPE test_waits_total counter
+test_waits_total 1e+06
+`
+
+func TestRegistryWriteTo(t *testing.T) {
+	r := NewRegistry()
+
+	requests := r.Counter("test_requests_total", "Requests.\nServed by \\ route.", "method", "route")
+	requests.Add(2.5, "GET", "/v1/tasks")
+	requests.Inc("GET", "/a\"b\\c\n")
+
+	r.Counter("test_rejected_total", "Rejected requests.")
+
+	duration := r.Histogram("test_duration_seconds", "Latency.", []float64{0.1, 1}, "method")
+	duration.Observe(1, "POST")
+	duration.Observe(0.0625, "GET")
+	duration.Observe(0.5, "GET")
+	duration.Observe(2, "GET")
+
+	r.GaugeFunc("test_connections_open", "Open connections.", func() float64 { return 3 })
+	r.CounterFunc("test_waits_total", "Waits.", func() float64 { return 1e6 })
+
+	var b strings.Builder
+	n, e := r.WriteTo(&b)
+	if e != nil {
+		t.Fatalf("WriteTo() = %v", e)
+	}
+
+	if b.String() != golden {
+		t.Errorf("WriteTo() wrote\n%s\nwant\n%s", b.String(), golden)
+	}
+	if n != int64(len(golden)) {
+		t.Errorf("WriteTo() = %d, want %d", n, len(golden))
+	}
+}
+
+func TestRegistryHandler(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("test_rejected_total", "Rejected requests.")
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type = %s, want the text exposition format", contentType)
+	}
+	if !strings.HasSuffix(w.Body.String(), "test_rejected_total 0\n") {
+		t.Errorf("body = %s", w.Body)
+	}
+}
+
+func TestSeriesPanicsOnLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc() with a missing label value did not panic")
+		}
+	}()
+
+	NewRegistry().Counter("test_requests_total", "Requests.", "method", "route").Inc("GET")
+}
@@ -1,9 +1,38 @@
 package search
 
-import "github.com/elastic/go-elasticsearch/v7"
+import (
+	"fmt"
+	"os"
 
-func NewClient() (*elasticsearch.Client, error) {
-	client, e := elasticsearch.NewDefaultClient()
+	"github.com/elastic/go-elasticsearch/v7"
+)
+
+// Config locates and authenticates against an Elasticsearch cluster and names
+// the index of the tasks.
+type Config struct {
+	Addresses []string
+	CACert    string
+	Index     string
+	Password  string
+	Username  string
+}
+
+func NewClient(config Config) (*elasticsearch.Client, error) {
+	es_config := elasticsearch.Config{
+		Addresses: config.Addresses,
+		Password:  config.Password,
+		Username:  config.Username,
+	}
+
+	if config.CACert != "" {
+		cert, e := os.ReadFile(config.CACert)
+		if e != nil {
+			return nil, fmt.Errorf("reading the CA certificate: %w", e)
+		}
+		es_config.CACert = cert
+	}
+
+	client, e := elasticsearch.NewClient(es_config)
 	if e != nil {
 		return nil, e
 	}
@@ -17,5 +46,9 @@ func NewClient() (*elasticsearch.Client, error) {
 		response.Body.Close()
 	}()
 
+	if response.IsError() {
+		return nil, fmt.Errorf("elasticsearch: %s", response.Status())
+	}
+
 	return client, nil
 }
@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"net/http"
 
 	"github.com/elastic/go-elasticsearch/v7"
 	"github.com/elastic/go-elasticsearch/v7/esapi"
 	"github.com/thomascastle/tarsk/internal/data"
+	"github.com/thomascastle/tarsk/internal/tracing"
 )
 
 type TaskIndexer struct {
@@ -16,14 +19,20 @@ type TaskIndexer struct {
 	index  string
 }
 
-func NewTaskIndexer(client *elasticsearch.Client) *TaskIndexer {
+func NewTaskIndexer(client *elasticsearch.Client, index string) *TaskIndexer {
 	return &TaskIndexer{
 		client: client,
-		index:  "tasks",
+		index:  index,
 	}
 }
 
-func (i *TaskIndexer) Delete(ctx context.Context, id string) error {
+func (i *TaskIndexer) Delete(ctx context.Context, id string) (e error) {
+	ctx, span := i.startSpan(ctx, "elasticsearch delete", id)
+	defer func() {
+		span.RecordError(e)
+		span.End()
+	}()
+
 	request := esapi.DeleteRequest{
 		Index:      i.index,
 		DocumentID: id,
@@ -35,8 +44,9 @@ func (i *TaskIndexer) Delete(ctx context.Context, id string) error {
 	}
 	defer response.Body.Close()
 
-	if response.IsError() {
-		return e
+	// A task which is not indexed is as good as deleted.
+	if response.IsError() && response.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("elasticsearch delete: %s", response.Status())
 	}
 
 	io.Copy(io.Discard, response.Body)
@@ -44,7 +54,13 @@ func (i *TaskIndexer) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
-func (i *TaskIndexer) Index(ctx context.Context, task data.Task) error {
+func (i *TaskIndexer) Index(ctx context.Context, task data.Task) (e error) {
+	ctx, span := i.startSpan(ctx, "elasticsearch index", task.ID)
+	defer func() {
+		span.RecordError(e)
+		span.End()
+	}()
+
 	var buf bytes.Buffer
 
 	if e := json.NewEncoder(&buf).Encode(task); e != nil {
@@ -65,10 +81,19 @@ func (i *TaskIndexer) Index(ctx context.Context, task data.Task) error {
 	defer response.Body.Close()
 
 	if response.IsError() {
-		return e
+		return fmt.Errorf("elasticsearch index: %s", response.Status())
 	}
 
 	io.Copy(io.Discard, response.Body)
 
 	return nil
 }
+
+func (i *TaskIndexer) startSpan(ctx context.Context, name, id string) (context.Context, *tracing.Span) {
+	ctx, span := tracing.Start(ctx, name)
+	span.SetAttribute("db.system", "elasticsearch")
+	span.SetAttribute("elasticsearch.document_id", id)
+	span.SetAttribute("elasticsearch.index", i.index)
+
+	return ctx, span
+}
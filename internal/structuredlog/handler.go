@@ -0,0 +1,85 @@
+package structuredlog
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Handler returns a log/slog handler writing through l, so that code logging
+// with slog, or with the log package once slog.SetDefault is called, shares
+// its output and levels. The attributes of a group are named after the group
+// and a dot, as in "request.method".
+func (l *Logger) Handler() slog.Handler {
+	return &handler{logger: l}
+}
+
+type handler struct {
+	group  string
+	logger *Logger
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return fromSlog(level) >= h.logger.Level()
+}
+
+func (h *handler) Handle(_ context.Context, record slog.Record) error {
+	properties := make(map[string]any, record.NumAttrs())
+	record.Attrs(func(attr slog.Attr) bool {
+		addAttr(properties, h.group, attr)
+		return true
+	})
+
+	_, e := h.logger.print(fromSlog(record.Level), record.Message, properties)
+
+	return e
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	properties := make(map[string]any, len(attrs))
+	for _, attr := range attrs {
+		addAttr(properties, h.group, attr)
+	}
+
+	return &handler{group: h.group, logger: h.logger.With(properties)}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	return &handler{group: h.group + name + ".", logger: h.logger}
+}
+
+func addAttr(properties map[string]any, prefix string, attr slog.Attr) {
+	value := attr.Value.Resolve()
+
+	if value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, member := range value.Group() {
+			addAttr(properties, prefix, member)
+		}
+		return
+	}
+
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	properties[prefix+attr.Key] = value.Any()
+}
+
+func fromSlog(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
@@ -2,16 +2,22 @@ package structuredlog
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
+	"os"
 	"runtime/debug"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Level uint8
 
 const (
-	LevelInfo Level = iota
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
 	LevelError
 	LevelFatal
 	LevelOff
@@ -19,65 +25,151 @@ const (
 
 func (l Level) String() string {
 	switch l {
+	case LevelDebug:
+		return "DEBUG"
 	case LevelInfo:
 		return "INFO"
+	case LevelWarn:
+		return "WARN"
 	case LevelError:
 		return "ERROR"
 	case LevelFatal:
 		return "FATAL"
+	case LevelOff:
+		return "OFF"
 	default:
 		return ""
 	}
 }
 
+// ParseLevel parses the name of a level, in any case.
+func ParseLevel(name string) (Level, error) {
+	for l := LevelDebug; l <= LevelOff; l++ {
+		if strings.EqualFold(name, l.String()) {
+			return l, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown level %q", name)
+}
+
+// Set implements flag.Value, so that a level can be configured with a flag.
+func (l *Level) Set(name string) error {
+	level, e := ParseLevel(name)
+	if e != nil {
+		return e
+	}
+	*l = level
+
+	return nil
+}
+
+// Config configures a logger. Stack traces are attached to the entries at
+// StackLevel and above.
+type Config struct {
+	Level      Level
+	StackLevel Level
+}
+
+// Logger writes entries as JSON objects, one per line. The loggers derived
+// from one with With share its output and levels.
 type Logger struct {
-	minLevel Level
-	mu       sync.Mutex
-	out      io.Writer
+	core       *core
+	properties map[string]any
+}
+
+type core struct {
+	exit       func(code int)
+	minLevel   atomic.Uint32
+	mu         sync.Mutex
+	out        io.Writer
+	stackLevel atomic.Uint32
 }
 
+// New returns a logger writing the entries at minLevel and above to out. Stack
+// traces are attached to fatal entries only, see SetStackLevel.
 func New(out io.Writer, minLevel Level) *Logger {
-	return &Logger{
-		minLevel: minLevel,
-		out:      out,
-	}
+	c := &core{exit: os.Exit, out: out}
+	c.minLevel.Store(uint32(minLevel))
+	c.stackLevel.Store(uint32(LevelFatal))
+
+	return &Logger{core: c}
 }
 
-func (l *Logger) Error(e error, properties map[string]string) {
-	l.print(LevelError, e.Error(), properties)
+// Configure applies a configuration to the logger and those derived from it.
+func (l *Logger) Configure(config Config) {
+	l.SetLevel(config.Level)
+	l.SetStackLevel(config.StackLevel)
 }
 
-func (l *Logger) Fatal(e error, properties map[string]string) {
-	l.print(LevelFatal, e.Error(), properties)
+// Level returns the minimum level of the entries written.
+func (l *Logger) Level() Level {
+	return Level(l.core.minLevel.Load())
+}
+
+// SetLevel changes the minimum level of the entries written. It is safe to
+// call while logging.
+func (l *Logger) SetLevel(level Level) {
+	l.core.minLevel.Store(uint32(level))
+}
+
+// SetStackLevel changes the minimum level of the entries a stack trace is
+// attached to; LevelOff attaches none.
+func (l *Logger) SetStackLevel(level Level) {
+	l.core.stackLevel.Store(uint32(level))
 }
 
-func (l *Logger) Info(message string, properties map[string]string) {
+// With returns a logger adding properties to every entry, overriding those
+// of l with the same names.
+func (l *Logger) With(properties map[string]any) *Logger {
+	return &Logger{core: l.core, properties: merge(l.properties, properties)}
+}
+
+func (l *Logger) Debug(message string, properties map[string]any) {
+	l.print(LevelDebug, message, properties)
+}
+
+func (l *Logger) Info(message string, properties map[string]any) {
 	l.print(LevelInfo, message, properties)
 }
 
+func (l *Logger) Warn(message string, properties map[string]any) {
+	l.print(LevelWarn, message, properties)
+}
+
+func (l *Logger) Error(e error, properties map[string]any) {
+	l.print(LevelError, e.Error(), properties)
+}
+
+// Fatal logs e and exits with status 1.
+func (l *Logger) Fatal(e error, properties map[string]any) {
+	l.print(LevelFatal, e.Error(), properties)
+	l.core.exit(1)
+}
+
 func (l *Logger) Write(message []byte) (int, error) {
 	return l.print(LevelError, string(message), nil)
 }
 
-func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
-	if level < l.minLevel {
+func (l *Logger) print(level Level, message string, properties map[string]any) (int, error) {
+	if level < l.Level() {
 		return 0, nil
 	}
 
 	entry := struct {
-		Level      string            `json:"level"`
-		Message    string            `json:"message"`
-		Properties map[string]string `json:"properties,omitempty"`
-		Time       string            `json:"time"`
-		Trace      string            `json:"trace,omitempty"`
+		Level      string         `json:"level"`
+		Message    string         `json:"message"`
+		Properties map[string]any `json:"properties,omitempty"`
+		Time       string         `json:"time"`
+		Trace      string         `json:"trace,omitempty"`
 	}{
 		Level:      level.String(),
 		Message:    message,
-		Properties: properties,
+		Properties: encodable(merge(l.properties, properties)),
 		Time:       time.Now().UTC().Format(time.RFC3339),
 	}
 
-	if level >= LevelError {
+	if level >= Level(l.core.stackLevel.Load()) {
 		entry.Trace = string(debug.Stack())
 	}
 
@@ -85,11 +177,56 @@ func (l *Logger) print(level Level, message string, properties map[string]string
 
 	line, e := json.Marshal(entry)
 	if e != nil {
-		line = []byte(LevelError.String() + ": unable to marshal log messaeg: " + e.Error())
+		line = []byte(LevelError.String() + ": unable to marshal log message: " + e.Error())
 	}
 
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	l.core.mu.Lock()
+	defer l.core.mu.Unlock()
+
+	return l.core.out.Write(append(line, '\n'))
+}
+
+func merge(a, b map[string]any) map[string]any {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+
+	merged := make(map[string]any, len(a)+len(b))
+	for key, value := range a {
+		merged[key] = value
+	}
+	for key, value := range b {
+		merged[key] = value
+	}
+
+	return merged
+}
+
+// encodable replaces the values which would not encode to JSON meaningfully,
+// such as errors, which encode to empty objects, by their text.
+func encodable(properties map[string]any) map[string]any {
+	if len(properties) == 0 {
+		return nil
+	}
+
+	encoded := make(map[string]any, len(properties))
+	for key, value := range properties {
+		switch value := value.(type) {
+		case time.Time:
+			encoded[key] = value
+		case error:
+			encoded[key] = value.Error()
+		case time.Duration:
+			encoded[key] = value.String()
+		case fmt.Stringer:
+			encoded[key] = value.String()
+		default:
+			encoded[key] = value
+		}
+	}
 
-	return l.out.Write(append(line, '\n'))
+	return encoded
 }
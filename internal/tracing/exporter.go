@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Config configures the tracer of a command.
+type Config struct {
+	File string
+}
+
+// NewTracerFromConfig returns the tracer of a service as configured, or nil
+// when tracing is disabled. The returned io.Closer closes the exporter.
+func NewTracerFromConfig(service string, config Config) (*Tracer, io.Closer, error) {
+	if config.File == "" {
+		return nil, nopCloser{}, nil
+	}
+
+	exporter, e := NewFileExporter(config.File)
+	if e != nil {
+		return nil, nil, e
+	}
+
+	return NewTracer(service, exporter), exporter, nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// FileExporter appends the spans to a file as JSON objects, one per line,
+// so that traces can be inspected without a collector.
+type FileExporter struct {
+	encoder *json.Encoder
+	file    *os.File
+	mu      sync.Mutex
+}
+
+func NewFileExporter(path string) (*FileExporter, error) {
+	file, e := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if e != nil {
+		return nil, e
+	}
+
+	return &FileExporter{encoder: json.NewEncoder(file), file: file}, nil
+}
+
+func (x *FileExporter) Export(span SpanData) {
+	record := struct {
+		Attributes   map[string]string `json:"attributes,omitempty"`
+		DurationMS   float64           `json:"duration_ms"`
+		End          time.Time         `json:"end"`
+		Error        string            `json:"error,omitempty"`
+		Name         string            `json:"name"`
+		ParentSpanID string            `json:"parent_span_id,omitempty"`
+		Service      string            `json:"service"`
+		SpanID       string            `json:"span_id"`
+		Start        time.Time         `json:"start"`
+		TraceID      string            `json:"trace_id"`
+	}{
+		Attributes: span.Attributes,
+		DurationMS: float64(span.End.Sub(span.Start).Microseconds()) / 1000,
+		End:        span.End.UTC(),
+		Error:      span.Error,
+		Name:       span.Name,
+		Service:    span.Service,
+		SpanID:     span.SpanID.String(),
+		Start:      span.Start.UTC(),
+		TraceID:    span.TraceID.String(),
+	}
+	if span.Parent != (SpanID{}) {
+		record.ParentSpanID = span.Parent.String()
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	// A span which cannot be written is dropped: tracing must not fail the
+	// traced operation.
+	x.encoder.Encode(record)
+}
+
+func (x *FileExporter) Close() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	return x.file.Close()
+}
@@ -0,0 +1,259 @@
+// Package tracing records spans, timed operations forming a tree per trace,
+// and propagates traces across processes in the W3C traceparent format.
+//
+// A nil *Tracer or *Span is valid and records nothing, so that code can be
+// instrumented unconditionally and tracing enabled by configuration only.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanContext identifies a span, possibly one of another process.
+type SpanContext struct {
+	SpanID  SpanID
+	TraceID TraceID
+}
+
+func (sc SpanContext) Valid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent formats the span context as a traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-01"
+}
+
+// ParseTraceparent parses a traceparent header value. It returns false when
+// the value is malformed or identifies no span.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	var sc SpanContext
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[3]) != 2 {
+		return sc, false
+	}
+	// Version 00 has exactly four fields; later versions may append more.
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+
+	if !decodeHex(sc.TraceID[:], parts[1]) || !decodeHex(sc.SpanID[:], parts[2]) {
+		return sc, false
+	}
+
+	return sc, sc.Valid()
+}
+
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s {
+		return false
+	}
+
+	_, e := hex.Decode(dst, []byte(s))
+
+	return e == nil
+}
+
+// SpanData is a finished span, as handed to an Exporter.
+type SpanData struct {
+	Attributes map[string]string
+	End        time.Time
+	Error      string
+	Name       string
+	Parent     SpanID
+	Service    string
+	SpanContext
+	Start time.Time
+}
+
+// Exporter ships finished spans. Export must be safe for concurrent use.
+type Exporter interface {
+	Export(span SpanData)
+}
+
+// Tracer starts the root spans of a service.
+type Tracer struct {
+	exporter Exporter
+	service  string
+}
+
+func NewTracer(service string, exporter Exporter) *Tracer {
+	return &Tracer{
+		exporter: exporter,
+		service:  service,
+	}
+}
+
+// Start starts a span which is the child of the span in ctx, or of the remote
+// parent in ctx (see ContextWithRemoteParent), or else the root of a new trace.
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	if parent := SpanFromContext(ctx); parent != nil {
+		return Start(ctx, name)
+	}
+
+	span := t.newSpan(name)
+	if remote, ok := ctx.Value(remoteParentContextKey).(SpanContext); ok {
+		span.data.TraceID = remote.TraceID
+		span.data.Parent = remote.SpanID
+	} else {
+		rand.Read(span.data.TraceID[:])
+	}
+
+	return ContextWithSpan(ctx, span), span
+}
+
+func (t *Tracer) newSpan(name string) *Span {
+	span := &Span{
+		data: SpanData{
+			Attributes: make(map[string]string),
+			Name:       name,
+			Service:    t.service,
+			Start:      time.Now(),
+		},
+		tracer: t,
+	}
+	rand.Read(span.data.SpanID[:])
+
+	return span
+}
+
+// Start starts a child of the span in ctx. When ctx carries no span, nothing
+// is traced and the returned span is nil.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+
+	span := parent.tracer.newSpan(name)
+	span.data.TraceID = parent.data.TraceID
+	span.data.Parent = parent.data.SpanID
+
+	return ContextWithSpan(ctx, span), span
+}
+
+type contextKey string
+
+const (
+	remoteParentContextKey = contextKey("remote_parent")
+	spanContextKey         = contextKey("span")
+)
+
+// ContextWithSpan returns a copy of ctx carrying span, the parent of the spans
+// started with it.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, spanContextKey, span)
+}
+
+// SpanFromContext returns the span carried by ctx, or nil if there is none.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey).(*Span)
+
+	return span
+}
+
+// ContextWithRemoteParent returns a copy of ctx carrying the span context of a
+// span of another process, such as one read from a traceparent header, so that
+// Tracer.Start continues its trace.
+func ContextWithRemoteParent(ctx context.Context, traceparent string) context.Context {
+	sc, ok := ParseTraceparent(traceparent)
+	if !ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, remoteParentContextKey, sc)
+}
+
+// Traceparent returns the traceparent of the span carried by ctx, or "" if
+// there is none.
+func Traceparent(ctx context.Context) string {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return ""
+	}
+
+	return span.data.Traceparent()
+}
+
+// Span is an operation being timed.
+type Span struct {
+	data   SpanData
+	ended  bool
+	mu     sync.Mutex
+	tracer *Tracer
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Attributes[key] = value
+}
+
+// RecordError marks the span as failed, unless e is nil.
+func (s *Span) RecordError(e error) {
+	if s == nil || e == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Error = e.Error()
+}
+
+// End ends the span and exports it. Only the first call has an effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+
+	data := s.data
+	data.Attributes = make(map[string]string, len(s.data.Attributes))
+	for key, value := range s.data.Attributes {
+		data.Attributes[key] = value
+	}
+	s.mu.Unlock()
+
+	if s.tracer.exporter != nil {
+		s.tracer.exporter.Export(data)
+	}
+}
@@ -0,0 +1,224 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/thomascastle/tarsk/internal/data"
+)
+
+// The claimed deliveries are attempted concurrently, so that a batch takes
+// about as long as its slowest attempt, which the lease outlasts.
+const (
+	maxAttempts    = 8
+	initialBackoff = 30 * time.Second
+	attemptTimeout = 10 * time.Second
+	claimLease     = 6 * attemptTimeout
+)
+
+var (
+	ErrorForbiddenAddress = errors.New("forbidden address")
+	ErrorUnknownEvent     = errors.New("unknown event")
+)
+
+// Dispatcher turns task events into webhook deliveries and delivers them,
+// retrying failed deliveries with an exponential backoff.
+type Dispatcher struct {
+	client     *http.Client
+	deliveries data.WebhookDeliveryRepository
+	webhooks   data.WebhookRepository
+}
+
+func NewDispatcher(repositories data.Repositories) *Dispatcher {
+	// Hosts are checked once resolved, when connecting, so that a webhook
+	// cannot reach a private address through its DNS records or a redirect.
+	// Redirects are not followed but fail the attempt.
+	dialer := &net.Dialer{Control: controlAddress, Timeout: attemptTimeout}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+
+	return &Dispatcher{
+		client: &http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+			Timeout:   attemptTimeout,
+			Transport: transport,
+		},
+		deliveries: repositories.WebhookDeliveries,
+		webhooks:   repositories.Webhooks,
+	}
+}
+
+// Enqueue records a pending delivery of the event for every webhook notified
+// of it. The payload of created and updated events is the task, the one of
+// deleted events its ID.
+func (d *Dispatcher) Enqueue(event string, payload []byte) error {
+	body := map[string]interface{}{
+		"event":       event,
+		"occurred_at": time.Now().UTC(),
+	}
+
+	switch event {
+	case "created", "updated":
+		body["task"] = json.RawMessage(payload)
+	case "deleted":
+		body["task_id"] = json.RawMessage(payload)
+	default:
+		return fmt.Errorf("%w: %s", ErrorUnknownEvent, event)
+	}
+
+	body_JSON, e := json.Marshal(body)
+	if e != nil {
+		return e
+	}
+
+	webhooks, e := d.webhooks.Select()
+	if e != nil {
+		return e
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Accepts(event) {
+			continue
+		}
+
+		e := d.deliveries.Insert(&data.WebhookDelivery{
+			Event:     event,
+			Payload:   body_JSON,
+			WebhookID: webhook.ID,
+		})
+		if e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
+
+// DeliverDue attempts up to limit pending deliveries which are due,
+// concurrently. It returns how many were attempted.
+func (d *Dispatcher) DeliverDue(ctx context.Context, limit int) (int, error) {
+	deliveries, e := d.deliveries.Claim(limit, claimLease)
+	if e != nil {
+		return 0, e
+	}
+
+	errs := make([]error, len(deliveries))
+
+	var wg sync.WaitGroup
+	for i, delivery := range deliveries {
+		wg.Add(1)
+		go func(i int, delivery *data.WebhookDelivery) {
+			defer wg.Done()
+			errs[i] = d.deliver(ctx, delivery)
+		}(i, delivery)
+	}
+	wg.Wait()
+
+	return len(deliveries), errors.Join(errs...)
+}
+
+// deliver attempts a claimed delivery and records the attempt.
+func (d *Dispatcher) deliver(ctx context.Context, delivery *data.WebhookDelivery) error {
+	webhook, e := d.webhooks.SelectOne(delivery.WebhookID)
+	if e != nil {
+		switch {
+		case errors.Is(e, data.ErrorRecordNotFound):
+			// The webhook was deleted along with its deliveries meanwhile.
+			return nil
+		default:
+			return e
+		}
+	}
+
+	attempt := d.attempt(ctx, webhook, delivery)
+
+	switch {
+	case attempt.Succeeded():
+		delivery.Status = data.WebhookDeliverySucceeded
+	case delivery.AttemptCount+1 >= maxAttempts:
+		delivery.Status = data.WebhookDeliveryFailed
+	default:
+		delivery.NextAttemptAt = time.Now().Add(initialBackoff << delivery.AttemptCount)
+	}
+
+	return d.deliveries.RecordAttempt(delivery, attempt)
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, webhook *data.Webhook, delivery *data.WebhookDelivery) data.WebhookDeliveryAttempt {
+	attempt := data.WebhookDeliveryAttempt{AttemptedAt: time.Now()}
+
+	request, e := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if e != nil {
+		attempt.Error = e.Error()
+		return attempt
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "Tarsk-Webhooks/1.0")
+	request.Header.Set("X-Tarsk-Delivery", delivery.ID)
+	request.Header.Set("X-Tarsk-Event", delivery.Event)
+	request.Header.Set("X-Tarsk-Signature", Sign(webhook.Secret, attempt.AttemptedAt, delivery.Payload))
+
+	response, e := d.client.Do(request)
+	attempt.Duration = int(time.Since(attempt.AttemptedAt).Milliseconds())
+	if e != nil {
+		attempt.Error = e.Error()
+		return attempt
+	}
+	defer response.Body.Close()
+
+	io.Copy(io.Discard, io.LimitReader(response.Body, 65_536))
+
+	attempt.ResponseStatus = response.StatusCode
+	if !attempt.Succeeded() {
+		attempt.Error = "unexpected response status: " + response.Status
+	}
+
+	return attempt
+}
+
+// controlAddress refuses the connections to the addresses webhooks must not
+// reach, see data.PublicIP.
+func controlAddress(_, address string, _ syscall.RawConn) error {
+	host, _, e := net.SplitHostPort(address)
+	if e != nil {
+		return e
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !data.PublicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrorForbiddenAddress, host)
+	}
+
+	return nil
+}
+
+// Sign returns the value of the X-Tarsk-Signature header: the Unix time of the
+// attempt and the hex-encoded HMAC-SHA256 of "<time>.<body>" keyed by the
+// webhook's secret, as in "t=1700000000,v1=5257a869...". Receivers recompute
+// the HMAC and reject old timestamps to prevent replays.
+func Sign(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,73 @@
+package webhooks
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/thomascastle/tarsk/internal/data"
+)
+
+func TestDispatcherRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the dispatcher reached a loopback address")
+	}))
+	defer server.Close()
+
+	d := NewDispatcher(data.Repositories{})
+
+	_, e := d.client.Get(server.URL)
+	if !errors.Is(e, ErrorForbiddenAddress) {
+		t.Errorf("Get(%s) error = %v, want %v", server.URL, e, ErrorForbiddenAddress)
+	}
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"type":"created","task_id":"42"}`)
+
+	// Computed with: printf '%s' '1700000000.<body>' | openssl dgst -sha256 -hmac whsec_test
+	want := "t=1700000000,v1=4df1bf419dce28ef13ede5aa821819c6e28223654cc390b67fa605dfba3f3db3"
+
+	if got := Sign("whsec_test", time.Unix(1700000000, 999), body); got != want {
+		t.Errorf("Sign() = %s, want %s", got, want)
+	}
+}
+
+func TestControlAddress(t *testing.T) {
+	tests := []struct {
+		address   string
+		forbidden bool
+	}{
+		{"93.184.216.34:443", false},
+		{"[2606:4700:4700::1111]:443", false},
+		{"127.0.0.1:80", true},
+		{"127.1.2.3:8080", true},
+		{"[::1]:80", true},
+		{"[::ffff:127.0.0.1]:80", true},
+		{"0.0.0.0:80", true},
+		{"[::]:80", true},
+		{"10.0.0.1:80", true},
+		{"172.16.0.1:80", true},
+		{"192.168.1.1:80", true},
+		{"[fd00::1]:80", true},
+		{"100.64.0.1:80", true},
+		{"169.254.169.254:80", true},
+		{"[fe80::1]:80", true},
+		{"224.0.0.1:80", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.address, func(t *testing.T) {
+			e := controlAddress("tcp", test.address, nil)
+
+			if test.forbidden && !errors.Is(e, ErrorForbiddenAddress) {
+				t.Errorf("controlAddress(%s) = %v, want %v", test.address, e, ErrorForbiddenAddress)
+			}
+			if !test.forbidden && e != nil {
+				t.Errorf("controlAddress(%s) = %v, want nil", test.address, e)
+			}
+		})
+	}
+}